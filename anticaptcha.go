@@ -1,10 +1,10 @@
 package anticaptcha
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"io/ioutil"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -18,6 +18,46 @@ type Settings struct {
 	MaxCheckAttempts int
 	MaxTimeAttempts  time.Duration
 	PingTime         time.Duration
+	// MaxInFlight limits the number of tasks solved at the same time by
+	// resolvers of one Anticaptcha, extra solves wait in a queue. Zero means
+	// no limit.
+	MaxInFlight int
+	// Proxies, when set, supplies proxies to proxy-on tasks created without
+	// one.
+	Proxies *ProxyPool
+	// AllowPrivateProxy allows proxies with private and loopback addresses.
+	AllowPrivateProxy bool
+	// Provider is the solving backend, AntiCaptcha when nil.
+	Provider Provider
+	// Logger, when set, receives events of task solving and api exchanges.
+	Logger Logger
+	// LogSecrets disables redaction of keys and image bodies in logs.
+	LogSecrets bool
+	// Metrics, when set, collects solving metrics.
+	Metrics Metrics
+	// Tracer, when set, creates spans for solves and api calls.
+	Tracer Tracer
+	// Middlewares wrap every api call, the first one is the outermost.
+	Middlewares []Middleware
+	// Keys, when set, is used instead of Key to create tasks.
+	Keys *KeyPool
+	// Budget, when set, refuses new tasks once a spend limit or the minimum
+	// balance is crossed.
+	Budget *Budget
+	// Tasks, when set, records created tasks until their result is
+	// collected, see Anticaptcha.Recover. Tasks of a Failover provider are
+	// not recorded.
+	Tasks TaskStore
+	// ImageCache, when set, answers repeated image captchas from a cache.
+	ImageCache *ImageCache
+	// MaxImageSize, when set, refuses image captchas larger than this many
+	// bytes before a task is created.
+	MaxImageSize int64
+	// ImagePreprocess, when set, converts image captchas before the size
+	// check and before they are sent.
+	ImagePreprocess *ImagePreprocess
+
+	queue *taskQueue
 }
 
 func (self *Settings) getClient() *http.Client {
@@ -44,98 +84,98 @@ func (self *Settings) getPingTime() time.Duration {
 	return self.PingTime
 }
 
-type Anticaptcha struct {
-	Settings
-}
+// waitResult calls check every ping time until it stops returning
+// ErrCaptchaInProcess, the check attempts are exceeded or ctx is done.
+func (self *Settings) waitResult(ctx context.Context, check func() error) error {
+	timer := time.NewTimer(self.getPingTime())
+	defer timer.Stop()
 
-func (self *Anticaptcha) ImageToTextResolver() *ImageToTextResolver {
-	return &ImageToTextResolver{
-		Settings: self.Settings,
-	}
-}
+	attempts := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
 
-func (self *Anticaptcha) Balance() (float64, error) {
-	reqdata := struct {
-		Key string `json:"clientKey"`
-	}{self.Key}
+		attempts++
 
-	reqbody, err := json.Marshal(reqdata)
-	if err != nil {
-		return 0, err
-	}
+		err := check()
+		if err != ErrCaptchaInProcess {
+			return err
+		}
 
-	resp, err := self.getClient().Post("https://api.anti-captcha.com/getBalance ", "application/json", bytes.NewReader(reqbody))
-	if err != nil {
-		return 0, err
-	}
+		if self.MaxCheckAttempts > 0 && attempts > self.MaxCheckAttempts {
+			return ErrAttemptsExceed
+		} else if int64(self.MaxTimeAttempts) > 0 && attempts*int(self.getPingTime().Seconds()) > int(self.MaxTimeAttempts.Seconds()) {
+			return ErrCheckTimeout
+		}
 
-	respbody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return 0, err
+		timer.Reset(self.getPingTime())
 	}
+}
 
-	var respdata struct {
-		respErr
-		Balance float64 `json:"balance"`
-	}
+type Anticaptcha struct {
+	Settings
 
-	if err := json.Unmarshal(respbody, &respdata); err != nil {
-		return 0, err
-	}
+	once sync.Once
+}
 
-	if respdata.ErrorId > 0 {
-		return 0, respdata.ToErr()
-	}
+func (self *Anticaptcha) settings() Settings {
+	self.once.Do(func() {
+		if self.queue == nil {
+			self.queue = newTaskQueue(self.MaxInFlight)
+		}
+	})
 
-	return respdata.Balance, nil
+	return self.Settings
 }
 
-type QueueStats struct {
-	Waiting int `json:"waiting"`
-	Load    int `json:"load"`
-	Bid     int `json:"bid"`
-	Speed   int `json:"speed"`
-	Total   int `json:"total"`
+// QueueDepth returns the number of solves waiting for a free slot.
+func (self *Anticaptcha) QueueDepth() int {
+	return self.settings().queue.depth()
 }
 
-func (self *Anticaptcha) QueueStats(queueId int) (*QueueStats, error) {
-	reqbody, err := json.Marshal(struct {
-		QueueId int `json:"queueId"`
-	}{queueId})
-	if err != nil {
-		return nil, err
-	}
+// InFlight returns the number of tasks being solved at the moment.
+func (self *Anticaptcha) InFlight() int {
+	return self.settings().queue.running()
+}
 
-	resp, err := self.getClient().Post("https://api.anti-captcha.com/getQueueStats", "application/json", bytes.NewReader(reqbody))
-	if err != nil {
-		return nil, err
+func (self *Anticaptcha) ImageToTextResolver() *ImageToTextResolver {
+	return &ImageToTextResolver{
+		Settings: self.settings(),
 	}
+}
 
-	respbody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+func (self *Anticaptcha) Balance() (float64, error) {
+	return self.Settings.balance()
+}
 
-	res := &QueueStats{}
-	if err := json.Unmarshal(respbody, res); err != nil {
-		return nil, err
+func (self *Settings) balance() (float64, error) {
+	return self.balanceContext(context.Background())
+}
+
+func (self *Settings) balanceContext(ctx context.Context) (float64, error) {
+	balance, err := self.getProvider().Balance(ctx, self)
+	if err == nil && self.Metrics != nil {
+		self.Metrics.Balance(balance)
 	}
 
-	return res, nil
+	return balance, err
 }
 
 func (self *Anticaptcha) NoCaptchaResolver() *NoCaptchaResolver {
 	return &NoCaptchaResolver{
-		Settings: self.Settings,
+		Settings: self.settings(),
 	}
 }
 
 func FromSettings(s Settings) *Anticaptcha {
-	return &Anticaptcha{s}
+	return &Anticaptcha{Settings: s}
 }
 
 func New(key string) *Anticaptcha {
-	return &Anticaptcha{Settings{Key: key}}
+	return &Anticaptcha{Settings: Settings{Key: key}}
 }
 
 type reqData struct {
@@ -154,25 +194,22 @@ func (self *respErr) ToErr() *ErrAntiCaptcha {
 	return &ErrAntiCaptcha{self.ErrorId, self.ErrorCode, self.ErrorDesc}
 }
 
-type respData struct {
-	respErr
-	TaskId int `json:"taskId"`
-}
-
-func parseTaskIdFromResp(resp *http.Response) (int, error) {
-	respbody, err := ioutil.ReadAll(resp.Body)
+// post sends reqdata to url and decodes the response into respdata, api
+// errors are returned as *ErrAntiCaptcha.
+func (self *Settings) post(ctx context.Context, url string, reqdata interface{}, respdata interface{}) error {
+	resp, err := self.roundTrip(ctx, &ApiRequest{Method: http.MethodPost, URL: url, Body: reqdata})
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	var respdata respData
-	if err := json.Unmarshal(respbody, &respdata); err != nil {
-		return 0, err
+	var resperr respErr
+	if err := json.Unmarshal(resp.Body, &resperr); err != nil {
+		return err
 	}
 
-	if respdata.ErrorId != 0 {
-		return 0, respdata.ToErr()
+	if resperr.ErrorId > 0 {
+		return resperr.ToErr()
 	}
 
-	return respdata.TaskId, nil
+	return json.Unmarshal(resp.Body, respdata)
 }
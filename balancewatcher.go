@@ -0,0 +1,118 @@
+package anticaptcha
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const BalanceBelow = "below"
+const BalanceAbove = "above"
+const BalanceDrop = "drop"
+
+// BalanceEvent is emitted by BalanceWatcher. Threshold is the crossed
+// threshold for BalanceBelow and BalanceAbove, and MaxDrop for BalanceDrop.
+type BalanceEvent struct {
+	Type      string
+	Balance   float64
+	Previous  float64
+	Threshold float64
+	Time      time.Time
+}
+
+// BalanceWatcher refreshes the balance every Interval and caches the last
+// value. OnEvent is called when the balance crosses one of Thresholds or
+// falls by more than MaxDrop between two refreshes.
+type BalanceWatcher struct {
+	Settings
+
+	Interval   time.Duration
+	Thresholds []float64
+	MaxDrop    float64
+	OnEvent    func(BalanceEvent)
+	OnError    func(error)
+
+	mu        sync.Mutex
+	last      float64
+	updatedAt time.Time
+}
+
+func (self *Anticaptcha) BalanceWatcher() *BalanceWatcher {
+	return &BalanceWatcher{
+		Settings: self.settings(),
+	}
+}
+
+func (self *BalanceWatcher) getInterval() time.Duration {
+	if int64(self.Interval) == 0 {
+		return time.Minute
+	}
+
+	return self.Interval
+}
+
+// Balance returns the last known balance and the time it was loaded, the
+// time is zero before the first refresh.
+func (self *BalanceWatcher) Balance() (float64, time.Time) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.last, self.updatedAt
+}
+
+// Run refreshes the balance until ctx is done and returns ctx.Err().
+func (self *BalanceWatcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(self.getInterval())
+	defer ticker.Stop()
+
+	for {
+		self.RefreshContext(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh loads the balance once and emits the events.
+func (self *BalanceWatcher) Refresh() {
+	self.RefreshContext(context.Background())
+}
+
+// RefreshContext is Refresh that stops loading the balance when ctx is done,
+// OnError is not called then.
+func (self *BalanceWatcher) RefreshContext(ctx context.Context) {
+	balance, err := self.Settings.balanceContext(ctx)
+	if err != nil {
+		if self.OnError != nil && ctx.Err() == nil {
+			self.OnError(err)
+		}
+		return
+	}
+
+	now := time.Now()
+
+	self.mu.Lock()
+	prev, first := self.last, self.updatedAt.IsZero()
+	self.last = balance
+	self.updatedAt = now
+	self.mu.Unlock()
+
+	if self.OnEvent == nil {
+		return
+	}
+
+	for _, t := range self.Thresholds {
+		if balance < t && (first || prev >= t) {
+			self.OnEvent(BalanceEvent{BalanceBelow, balance, prev, t, now})
+		} else if balance >= t && !first && prev < t {
+			self.OnEvent(BalanceEvent{BalanceAbove, balance, prev, t, now})
+		}
+	}
+
+	if !first && self.MaxDrop > 0 && prev-balance > self.MaxDrop {
+		self.OnEvent(BalanceEvent{BalanceDrop, balance, prev, self.MaxDrop, now})
+	}
+}
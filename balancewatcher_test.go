@@ -0,0 +1,79 @@
+package anticaptcha
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type balanceProvider struct {
+	fakeProvider
+	balances []float64
+	started  chan struct{}
+}
+
+func (self *balanceProvider) Balance(ctx context.Context, s *Settings) (float64, error) {
+	if len(self.balances) == 0 {
+		close(self.started)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+
+	balance := self.balances[0]
+	self.balances = self.balances[1:]
+	return balance, nil
+}
+
+func TestBalanceWatcher_Events(t *testing.T) {
+	var events []string
+	w := FromSettings(Settings{Provider: &balanceProvider{balances: []float64{5, 3, 0.5, 2}}}).BalanceWatcher()
+	w.Thresholds = []float64{1}
+	w.MaxDrop = 1.5
+	w.OnEvent = func(e BalanceEvent) {
+		events = append(events, e.Type)
+	}
+
+	for i := 0; i < 4; i++ {
+		w.Refresh()
+	}
+
+	want := []string{BalanceDrop, BalanceBelow, BalanceDrop, BalanceAbove}
+	if len(events) != len(want) {
+		t.Fatalf("expected %v, got %v", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, events)
+		}
+	}
+
+	if balance, at := w.Balance(); balance != 2 || at.IsZero() {
+		t.Fatalf("unexpected balance %v at %v", balance, at)
+	}
+}
+
+func TestBalanceWatcher_RunCancel(t *testing.T) {
+	provider := &balanceProvider{started: make(chan struct{})}
+	w := FromSettings(Settings{Provider: provider}).BalanceWatcher()
+	w.OnError = func(err error) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Run(ctx)
+	}()
+
+	<-provider.started
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not stop the balance request")
+	}
+}
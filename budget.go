@@ -0,0 +1,304 @@
+package anticaptcha
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Budget tracks the spend of tasks solved by resolvers and refuses new tasks
+// with *ErrBudgetExceeded once a limit would be crossed. Spend is taken from
+// TaskResult.Cost, the account balance is refreshed every BalanceRefresh and
+// lowered by the spend in between. Tasks are refused while MinBalance is set
+// and the balance could never be loaded. Zero limits are not checked.
+type Budget struct {
+	HourlyLimit    float64
+	DailyLimit     float64
+	MinBalance     float64
+	BalanceRefresh time.Duration
+	// TaskCost is reserved against the limits for every task from its
+	// creation until its cost is known, 0.002 when zero.
+	TaskCost float64
+	// TaskHold is how long the reservation of a task created with the int
+	// based api is kept when its result is never loaded, 10 minutes when
+	// zero.
+	TaskHold time.Duration
+	// OnLowBalance is called once each time the balance falls below
+	// MinBalance.
+	OnLowBalance func(balance float64)
+
+	mu         sync.Mutex
+	spent      float64
+	hour       time.Time
+	hourSpent  float64
+	day        time.Time
+	daySpent   float64
+	balance    float64
+	balanceAt  time.Time
+	refreshing bool
+	low        bool
+	reserved   float64
+	tasks      map[string]heldCost
+
+	refreshErrors int
+}
+
+// heldCost is the reservation of a task created with the int based api.
+type heldCost struct {
+	cost    float64
+	expires time.Time
+}
+
+const defaultTaskCost = 0.002
+const defaultTaskHold = 10 * time.Minute
+
+func (self *Budget) getBalanceRefresh() time.Duration {
+	if int64(self.BalanceRefresh) == 0 {
+		return 5 * time.Minute
+	}
+
+	return self.BalanceRefresh
+}
+
+func (self *Budget) getTaskCost() float64 {
+	if self.TaskCost == 0 {
+		return defaultTaskCost
+	}
+
+	return self.TaskCost
+}
+
+func (self *Budget) getTaskHold() time.Duration {
+	if int64(self.TaskHold) == 0 {
+		return defaultTaskHold
+	}
+
+	return self.TaskHold
+}
+
+// Spent returns the total spend since the budget was created.
+func (self *Budget) Spent() float64 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.spent
+}
+
+// HourlySpent returns the spend of the current hour.
+func (self *Budget) HourlySpent() float64 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.rollover(time.Now())
+	return self.hourSpent
+}
+
+// DailySpent returns the spend of the current day (UTC).
+func (self *Budget) DailySpent() float64 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.rollover(time.Now())
+	return self.daySpent
+}
+
+// Balance returns the last known balance, it is zero until the first refresh.
+func (self *Budget) Balance() float64 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.balance
+}
+
+// RefreshErrors returns how many balance refreshes have failed.
+func (self *Budget) RefreshErrors() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.refreshErrors
+}
+
+func (self *Budget) rollover(now time.Time) {
+	if hour := now.UTC().Truncate(time.Hour); !hour.Equal(self.hour) {
+		self.hour = hour
+		self.hourSpent = 0
+	}
+
+	if day := now.UTC().Truncate(24 * time.Hour); !day.Equal(self.day) {
+		self.day = day
+		self.daySpent = 0
+	}
+}
+
+// reserve refuses a task that would cross a limit, otherwise it reserves
+// TaskCost until release is called with the returned reservation.
+func (self *Budget) reserve(s *Settings) (float64, error) {
+	if self == nil {
+		return 0, nil
+	}
+
+	if self.MinBalance > 0 {
+		if err := self.refreshBalance(s); err != nil {
+			return 0, err
+		}
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.rollover(time.Now())
+	self.pruneTasks()
+
+	cost := self.getTaskCost()
+
+	if self.HourlyLimit > 0 && self.hourSpent+self.reserved+cost > self.HourlyLimit {
+		return 0, &ErrBudgetExceeded{BudgetHourly, self.hourSpent + self.reserved, self.HourlyLimit}
+	}
+
+	if self.DailyLimit > 0 && self.daySpent+self.reserved+cost > self.DailyLimit {
+		return 0, &ErrBudgetExceeded{BudgetDaily, self.daySpent + self.reserved, self.DailyLimit}
+	}
+
+	if self.MinBalance > 0 && !self.balanceAt.IsZero() && self.balance-self.reserved-cost < self.MinBalance {
+		return 0, &ErrBudgetExceeded{BudgetBalance, self.balance - self.reserved, self.MinBalance}
+	}
+
+	self.reserved += cost
+	return cost, nil
+}
+
+// release drops a reservation and adds the cost of the task, which is zero
+// when the task failed.
+func (self *Budget) release(reserved float64, cost float64) {
+	if self == nil {
+		return
+	}
+
+	self.mu.Lock()
+	self.reserved -= reserved
+	self.mu.Unlock()
+
+	self.add(cost)
+}
+
+// hold keeps the reservation of a task created with the int based api until
+// its result is loaded or TaskHold has passed.
+func (self *Budget) hold(taskId string, reserved float64) {
+	if self == nil {
+		return
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.tasks == nil {
+		self.tasks = make(map[string]heldCost)
+	}
+
+	self.tasks[taskId] = heldCost{reserved, time.Now().Add(self.getTaskHold())}
+}
+
+// releaseTask releases the reservation of a task held with hold.
+func (self *Budget) releaseTask(taskId string, cost float64) {
+	if self == nil {
+		return
+	}
+
+	self.mu.Lock()
+	held := self.tasks[taskId]
+	delete(self.tasks, taskId)
+	self.mu.Unlock()
+
+	self.release(held.cost, cost)
+}
+
+// pruneTasks releases held reservations older than TaskHold, the caller must
+// hold the lock.
+func (self *Budget) pruneTasks() {
+	now := time.Now()
+	for taskId, held := range self.tasks {
+		if now.After(held.expires) {
+			self.reserved -= held.cost
+			delete(self.tasks, taskId)
+		}
+	}
+}
+
+// refreshBalance loads the balance if it is older than BalanceRefresh, the
+// balances of all keys are summed when s has a KeyPool. A failed refresh is
+// retried on the next check, meanwhile the last balance lowered by the spend
+// is used. It fails when no balance was ever loaded.
+func (self *Budget) refreshBalance(s *Settings) error {
+	self.mu.Lock()
+	if self.refreshing || (!self.balanceAt.IsZero() && time.Since(self.balanceAt) < self.getBalanceRefresh()) {
+		self.mu.Unlock()
+		return nil
+	}
+	self.refreshing = true
+	self.mu.Unlock()
+
+	var balance float64
+	var err error
+	if s.Keys != nil {
+		balance, err = s.Keys.Balance(context.Background(), s)
+	} else {
+		balance, err = s.balance()
+	}
+
+	self.mu.Lock()
+	self.refreshing = false
+	if err != nil {
+		self.refreshErrors++
+		known := !self.balanceAt.IsZero()
+		self.mu.Unlock()
+		if known {
+			return nil
+		}
+		return err
+	}
+	self.balance = balance
+	self.balanceAt = time.Now()
+	notify := self.setLow()
+	self.mu.Unlock()
+
+	if notify {
+		self.OnLowBalance(balance)
+	}
+
+	return nil
+}
+
+func (self *Budget) add(cost float64) {
+	if self == nil {
+		return
+	}
+
+	self.mu.Lock()
+	self.rollover(time.Now())
+	self.spent += cost
+	self.hourSpent += cost
+	self.daySpent += cost
+	if !self.balanceAt.IsZero() {
+		self.balance -= cost
+	}
+	balance := self.balance
+	notify := self.setLow()
+	self.mu.Unlock()
+
+	if notify {
+		self.OnLowBalance(balance)
+	}
+}
+
+// setLow updates the low balance flag and reports whether the callback
+// should be fired, the caller must hold the lock.
+func (self *Budget) setLow() bool {
+	if self.MinBalance <= 0 || self.balanceAt.IsZero() {
+		return false
+	}
+
+	low := self.balance < self.MinBalance
+	notify := low && !self.low && self.OnLowBalance != nil
+	self.low = low
+	return notify
+}
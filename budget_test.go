@@ -0,0 +1,169 @@
+package anticaptcha
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBudget_Reserve(t *testing.T) {
+	budget := &Budget{HourlyLimit: 0.005, TaskCost: 0.002}
+
+	first, err := budget.reserve(&Settings{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err := budget.reserve(&Settings{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err = budget.reserve(&Settings{})
+	if e, ok := err.(*ErrBudgetExceeded); !ok || e.Limit != BudgetHourly {
+		t.Fatalf("expected hourly limit, got %v", err)
+	}
+
+	budget.release(first, 0)
+	if _, err := budget.reserve(&Settings{}); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestBudget_Solve(t *testing.T) {
+	budget := &Budget{HourlyLimit: 0.003, TaskCost: 0.002}
+	ac := FromSettings(Settings{
+		PingTime: time.Millisecond,
+		Budget:   budget,
+		Provider: &fakeProvider{readyAt: 1, cost: 0.002},
+	})
+
+	if _, err := ac.ImageToTextResolver().ResolveBytes([]byte("image"), nil); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if budget.HourlySpent() != 0.002 {
+		t.Fatalf("unexpected spend %v", budget.HourlySpent())
+	}
+
+	_, err := ac.ImageToTextResolver().ResolveBytes([]byte("image"), nil)
+	if _, ok := err.(*ErrBudgetExceeded); !ok {
+		t.Fatalf("expected budget error, got %v", err)
+	}
+}
+
+func TestBudget_CreateTask(t *testing.T) {
+	budget := &Budget{HourlyLimit: 0.003, TaskCost: 0.002}
+	ac := FromSettings(Settings{
+		Budget:   budget,
+		Provider: &fakeProvider{readyAt: 1, cost: 0.001},
+	})
+	resolver := ac.ImageToTextResolver()
+
+	taskId, err := resolver.CreateTask([]byte("image"), nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err = resolver.CreateTask([]byte("image"), nil)
+	if _, ok := err.(*ErrBudgetExceeded); !ok {
+		t.Fatalf("expected budget error, got %v", err)
+	}
+
+	if _, err := resolver.TaskResult(taskId); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if budget.HourlySpent() != 0.001 {
+		t.Fatalf("unexpected spend %v", budget.HourlySpent())
+	}
+
+	if _, err := resolver.CreateTask([]byte("image"), nil); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestBudget_TaskHold(t *testing.T) {
+	budget := &Budget{HourlyLimit: 0.003, TaskCost: 0.002, TaskHold: time.Millisecond}
+
+	reserved, err := budget.reserve(&Settings{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	budget.hold("1", reserved)
+
+	time.Sleep(2 * time.Millisecond)
+
+	if _, err := budget.reserve(&Settings{}); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+// keyBalanceProvider returns the balance of the request key and fails for
+// unknown keys.
+type keyBalanceProvider struct {
+	fakeProvider
+
+	balances map[string]float64
+}
+
+func (self *keyBalanceProvider) Balance(ctx context.Context, s *Settings) (float64, error) {
+	balance, ok := self.balances[s.Key]
+	if !ok {
+		return 0, &ErrAntiCaptcha{1, ErrorKeyDoesNotExist, ""}
+	}
+
+	return balance, nil
+}
+
+func TestBudget_KeysBalance(t *testing.T) {
+	budget := &Budget{MinBalance: 2.5}
+	s := &Settings{
+		Keys:     &KeyPool{Keys: []string{"a", "b"}},
+		Provider: &keyBalanceProvider{balances: map[string]float64{"a": 1, "b": 2}},
+	}
+
+	if _, err := budget.reserve(s); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if budget.Balance() != 3 {
+		t.Fatalf("expected balance 3, got %v", budget.Balance())
+	}
+}
+
+func TestBudget_RefreshError(t *testing.T) {
+	budget := &Budget{MinBalance: 1}
+	s := &Settings{Provider: &keyBalanceProvider{}}
+
+	_, err := budget.reserve(s)
+	if e, ok := err.(*ErrAntiCaptcha); !ok || e.Code != ErrorKeyDoesNotExist {
+		t.Fatalf("expected refresh error, got %v", err)
+	}
+
+	if budget.RefreshErrors() != 1 {
+		t.Fatalf("expected 1 refresh error, got %d", budget.RefreshErrors())
+	}
+}
+
+func TestBudget_TransientPoll(t *testing.T) {
+	budget := &Budget{HourlyLimit: 0.003, TaskCost: 0.002}
+	ac := FromSettings(Settings{
+		Budget:   budget,
+		Provider: &keyProvider{fakeProvider: fakeProvider{readyAt: 1}},
+	})
+	resolver := ac.ImageToTextResolver()
+
+	taskId, err := resolver.CreateTask([]byte("image"), nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err := resolver.TaskResult(taskId); err == nil {
+		t.Fatal("expected transient error")
+	}
+
+	_, err = resolver.CreateTask([]byte("image"), nil)
+	if _, ok := err.(*ErrBudgetExceeded); !ok {
+		t.Fatalf("expected the running task to stay reserved, got %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package anticaptcha
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const defaultCacheTTL = time.Hour
+const defaultCacheEntries = 1000
+const defaultCacheTasks = 10000
+
+// SolutionCache stores cached image captcha answers. Keys are opaque strings,
+// entries should be dropped once ttl has passed.
+type SolutionCache interface {
+	Get(key string) (CachedSolution, bool)
+	Set(key string, solution CachedSolution, ttl time.Duration)
+	Delete(key string)
+}
+
+// CachedSolution is the answer of the task TaskId.
+type CachedSolution struct {
+	TaskId   int                 `json:"taskId"`
+	Solution ImageToTextSolution `json:"solution"`
+}
+
+// ImageCache answers image captchas seen before without creating a task.
+// Answers are keyed by a hash of the image and the task options and are
+// evicted when their task is reported incorrect.
+type ImageCache struct {
+	// Backend stores the answers, an LRUCache of 1000 entries when nil.
+	Backend SolutionCache
+	// TTL is how long answers are kept, one hour when zero.
+	TTL time.Duration
+	// MaxTasks bounds the task ids of cached answers remembered for
+	// ReportIncorrect, 10000 when zero. Ids of answers served from the cache
+	// are dropped last.
+	MaxTasks int
+
+	once sync.Once
+
+	mu    sync.Mutex
+	order *list.List
+	tasks map[int]*list.Element
+}
+
+// cachedTask links a task id to the key of its answer.
+type cachedTask struct {
+	taskId  int
+	key     string
+	expires time.Time
+}
+
+func (self *ImageCache) getBackend() SolutionCache {
+	self.once.Do(func() {
+		if self.Backend == nil {
+			self.Backend = NewLRUCache(defaultCacheEntries)
+		}
+		self.order = list.New()
+		self.tasks = map[int]*list.Element{}
+	})
+
+	return self.Backend
+}
+
+func (self *ImageCache) getTTL() time.Duration {
+	if int64(self.TTL) == 0 {
+		return defaultCacheTTL
+	}
+
+	return self.TTL
+}
+
+func (self *ImageCache) getMaxTasks() int {
+	if self.MaxTasks == 0 {
+		return defaultCacheTasks
+	}
+
+	return self.MaxTasks
+}
+
+// key hashes the task options, the language and the image.
+func (self *ImageCache) key(task *imageToTextTask, lang string) (string, error) {
+	data, err := json.Marshal(task.ImageToTextTask)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write(data)
+	h.Write([]byte(lang))
+	if err := task.Body.writeTo(h); err != nil {
+		return "", err
+	}
+
+	return "image:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (self *ImageCache) get(key string) (CachedSolution, bool) {
+	if self == nil {
+		return CachedSolution{}, false
+	}
+
+	cached, ok := self.getBackend().Get(key)
+	if ok {
+		self.mu.Lock()
+		if el, ok := self.tasks[cached.TaskId]; ok {
+			self.order.MoveToFront(el)
+		}
+		self.mu.Unlock()
+	}
+
+	return cached, ok
+}
+
+func (self *ImageCache) set(key string, taskId int, solution ImageToTextSolution) {
+	if self == nil || solution.Text == "" {
+		return
+	}
+
+	self.getBackend().Set(key, CachedSolution{TaskId: taskId, Solution: solution}, self.getTTL())
+
+	// answers without a numeric task id can not be reported
+	if taskId == 0 {
+		return
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if el, ok := self.tasks[taskId]; ok {
+		self.removeTask(el)
+	}
+	self.tasks[taskId] = self.order.PushFront(&cachedTask{taskId, key, time.Now().Add(self.getTTL())})
+
+	// answers of expired entries are gone from the backend as well
+	now := time.Now()
+	for el := self.order.Back(); el != nil; el = self.order.Back() {
+		if self.order.Len() <= self.getMaxTasks() && now.Before(el.Value.(*cachedTask).expires) {
+			break
+		}
+		self.removeTask(el)
+	}
+}
+
+// evict drops the answer of taskId.
+func (self *ImageCache) evict(taskId int) {
+	if self == nil {
+		return
+	}
+
+	backend := self.getBackend()
+
+	self.mu.Lock()
+	el, ok := self.tasks[taskId]
+	if ok {
+		self.removeTask(el)
+	}
+	self.mu.Unlock()
+
+	if ok {
+		backend.Delete(el.Value.(*cachedTask).key)
+	}
+}
+
+func (self *ImageCache) removeTask(el *list.Element) {
+	self.order.Remove(el)
+	delete(self.tasks, el.Value.(*cachedTask).taskId)
+}
+
+// LRUCache is an in-memory SolutionCache holding at most MaxEntries entries,
+// the least recently used entry is dropped first.
+type LRUCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key      string
+	solution CachedSolution
+	expires  time.Time
+}
+
+func NewLRUCache(maxEntries int) *LRUCache {
+	return &LRUCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    map[string]*list.Element{},
+	}
+}
+
+func (self *LRUCache) Get(key string) (CachedSolution, bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	el, ok := self.entries[key]
+	if !ok {
+		return CachedSolution{}, false
+	}
+
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		self.remove(el)
+		return CachedSolution{}, false
+	}
+
+	self.order.MoveToFront(el)
+	return entry.solution, true
+}
+
+func (self *LRUCache) Set(key string, solution CachedSolution, ttl time.Duration) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if el, ok := self.entries[key]; ok {
+		self.remove(el)
+	}
+
+	self.entries[key] = self.order.PushFront(&lruEntry{key, solution, time.Now().Add(ttl)})
+
+	for self.maxEntries > 0 && self.order.Len() > self.maxEntries {
+		self.remove(self.order.Back())
+	}
+}
+
+func (self *LRUCache) Delete(key string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if el, ok := self.entries[key]; ok {
+		self.remove(el)
+	}
+}
+
+// Len returns the number of entries, expired ones included.
+func (self *LRUCache) Len() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.order.Len()
+}
+
+func (self *LRUCache) remove(el *list.Element) {
+	self.order.Remove(el)
+	delete(self.entries, el.Value.(*lruEntry).key)
+}
@@ -0,0 +1,92 @@
+package anticaptcha
+
+import (
+	"testing"
+	"time"
+)
+
+func TestImageCache(t *testing.T) {
+	provider := &fakeProvider{readyAt: 1}
+	ac := FromSettings(Settings{
+		PingTime:   time.Millisecond,
+		Provider:   provider,
+		ImageCache: &ImageCache{},
+	})
+	resolver := ac.ImageToTextResolver()
+
+	res, err := resolver.ResolveBytes([]byte("image"), nil)
+	if err != nil || res.Cached {
+		t.Fatalf("unexpected first result %+v, %v", res, err)
+	}
+
+	res, err = resolver.ResolveBytes([]byte("image"), nil)
+	if err != nil || !res.Cached || res.Solution.Text != "answer" || res.TaskId != 1 {
+		t.Fatalf("unexpected cached result %+v, %v", res, err)
+	}
+
+	res, err = resolver.ResolveBytes([]byte("image"), &ImageToTextTask{Case: true})
+	if err != nil || res.Cached {
+		t.Fatalf("answer with other options is cached: %+v, %v", res, err)
+	}
+
+	// the fake provider does not accept reports, the answer is evicted anyway
+	resolver.ReportIncorrect(1)
+
+	res, err = resolver.ResolveBytes([]byte("image"), nil)
+	if err != nil || res.Cached {
+		t.Fatalf("reported answer is cached: %+v, %v", res, err)
+	}
+}
+
+func TestImageCache_ReportAfterHits(t *testing.T) {
+	ac := FromSettings(Settings{
+		PingTime:   time.Millisecond,
+		Provider:   &fakeProvider{readyAt: 1},
+		ImageCache: &ImageCache{Backend: NewLRUCache(2), MaxTasks: 2},
+	})
+	resolver := ac.ImageToTextResolver()
+
+	resolver.ResolveBytes([]byte("a"), nil)
+	resolver.ResolveBytes([]byte("b"), nil)
+
+	// hits keep the answer of a in the cache while b and c come and go
+	for i := 0; i < 3; i++ {
+		if res, err := resolver.ResolveBytes([]byte("a"), nil); err != nil || !res.Cached {
+			t.Fatalf("unexpected result %+v, %v", res, err)
+		}
+	}
+	resolver.ResolveBytes([]byte("c"), nil)
+
+	res, err := resolver.ResolveBytes([]byte("a"), nil)
+	if err != nil || !res.Cached || res.TaskId != 1 {
+		t.Fatalf("unexpected result %+v, %v", res, err)
+	}
+
+	resolver.ReportIncorrect(1)
+
+	res, err = resolver.ResolveBytes([]byte("a"), nil)
+	if err != nil || res.Cached {
+		t.Fatalf("reported answer is cached: %+v, %v", res, err)
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	cache := NewLRUCache(2)
+	cache.Set("a", CachedSolution{TaskId: 1}, time.Hour)
+	cache.Set("b", CachedSolution{TaskId: 2}, time.Hour)
+	cache.Get("a")
+	cache.Set("c", CachedSolution{TaskId: 3}, time.Hour)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Fatal("least recently used entry is not evicted")
+	}
+
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("recently used entry is evicted")
+	}
+
+	cache.Set("d", CachedSolution{TaskId: 4}, -time.Second)
+	if _, ok := cache.Get("d"); ok {
+		t.Fatal("expired entry is returned")
+	}
+}
@@ -0,0 +1,178 @@
+// Command anticaptcha-gateway exposes a small REST api for solving captchas
+// so that services not written in Go share one api key, budget, retry
+// policy and metrics.
+//
+//	POST /tasks                      submit a task in the createTask format
+//	GET  /tasks/{id}                 task status
+//	GET  /tasks/{id}/result?wait=30s wait for the task to finish
+//	GET  /balance                    account balance, the total of all keys
+//	GET  /healthz                    queue and task counters
+//	GET  /metrics                    prometheus metrics
+//
+// The api key is read from ANTICAPTCHA_KEY, several comma separated keys
+// from ANTICAPTCHA_KEYS. When GATEWAY_TOKEN is set clients must send it as
+// a bearer token.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sintanial/go-anticaptcha"
+	acprometheus "github.com/sintanial/go-anticaptcha/prometheus"
+)
+
+var providers = map[string]anticaptcha.Provider{
+	"anticaptcha": anticaptcha.AntiCaptcha,
+	"capmonster":  anticaptcha.CapMonsterCloud,
+	"capsolver":   anticaptcha.CapSolver,
+	"2captcha":    anticaptcha.TwoCaptcha,
+}
+
+type config struct {
+	addr            string
+	provider        string
+	maxInFlight     int
+	budget          anticaptcha.Budget
+	retries         int
+	retryDelay      time.Duration
+	maxWait         time.Duration
+	ttl             time.Duration
+	shutdownTimeout time.Duration
+}
+
+func main() {
+	cfg := &config{}
+	flag.StringVar(&cfg.addr, "addr", ":8080", "listen address")
+	flag.StringVar(&cfg.provider, "provider", "anticaptcha", "anticaptcha, capmonster, capsolver or 2captcha")
+	flag.IntVar(&cfg.maxInFlight, "max-in-flight", 0, "maximum number of tasks solved at the same time")
+	flag.Float64Var(&cfg.budget.HourlyLimit, "hourly-limit", 0, "maximum spend per hour")
+	flag.Float64Var(&cfg.budget.DailyLimit, "daily-limit", 0, "maximum spend per day")
+	flag.Float64Var(&cfg.budget.MinBalance, "min-balance", 0, "refuse tasks below this balance")
+	flag.IntVar(&cfg.retries, "retries", 2, "retries of tasks failed with retryable errors")
+	flag.DurationVar(&cfg.retryDelay, "retry-delay", 5*time.Second, "delay between retries")
+	flag.DurationVar(&cfg.maxWait, "max-wait", time.Minute, "maximum long-poll duration")
+	flag.DurationVar(&cfg.ttl, "ttl", time.Hour, "how long finished tasks are kept")
+	flag.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 30*time.Second, "time given to running tasks on shutdown")
+	flag.Parse()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	if err := run(cfg, logger); err != nil {
+		logger.Error("gateway failed", "error", err.Error())
+		os.Exit(1)
+	}
+}
+
+// newSettings builds the client settings from cfg and the key variables.
+func newSettings(cfg *config, logger *slog.Logger) (anticaptcha.Settings, error) {
+	provider, ok := providers[cfg.provider]
+	if !ok {
+		return anticaptcha.Settings{}, errors.New("unknown provider " + cfg.provider)
+	}
+
+	settings := anticaptcha.Settings{
+		Key:         os.Getenv("ANTICAPTCHA_KEY"),
+		Provider:    provider,
+		MaxInFlight: cfg.maxInFlight,
+		Logger:      logger,
+	}
+
+	if keys := os.Getenv("ANTICAPTCHA_KEYS"); keys != "" {
+		settings.Keys = &anticaptcha.KeyPool{Keys: strings.Split(keys, ",")}
+	} else if settings.Key == "" {
+		return settings, errors.New("api key is not set, use ANTICAPTCHA_KEY or ANTICAPTCHA_KEYS")
+	}
+
+	// with several keys the budget checks the total balance of the pool
+	if cfg.budget.HourlyLimit > 0 || cfg.budget.DailyLimit > 0 || cfg.budget.MinBalance > 0 {
+		settings.Budget = &cfg.budget
+	}
+
+	return settings, nil
+}
+
+func run(cfg *config, logger *slog.Logger) error {
+	settings, err := newSettings(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	metrics, err := acprometheus.New("anticaptcha", prometheus.DefaultRegisterer)
+	if err != nil {
+		return err
+	}
+	settings.Metrics = metrics
+
+	tasksCtx, cancelTasks := context.WithCancel(context.Background())
+	defer cancelTasks()
+
+	srv := &server{
+		ac:         anticaptcha.FromSettings(settings),
+		store:      newStore(cfg.ttl),
+		logger:     logger,
+		token:      os.Getenv("GATEWAY_TOKEN"),
+		retries:    cfg.retries,
+		retryDelay: cfg.retryDelay,
+		maxWait:    cfg.maxWait,
+		ctx:        tasksCtx,
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", srv.handler())
+	mux.Handle("/metrics", promhttp.Handler())
+
+	httpSrv := &http.Server{Addr: cfg.addr, Handler: mux}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		logger.Info("gateway listening", "addr", cfg.addr)
+		errc <- httpSrv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+	defer cancel()
+
+	// new tasks are refused, running tasks get the timeout to finish and
+	// pending long-polls are answered as they do
+	tasksDone := make(chan struct{})
+	go func() {
+		srv.drain()
+		close(tasksDone)
+	}()
+
+	select {
+	case <-tasksDone:
+	case <-shutdownCtx.Done():
+		logger.Warn("cancelling running tasks")
+		cancelTasks()
+		<-tasksDone
+	}
+
+	if err := httpSrv.Shutdown(shutdownCtx); err != nil {
+		httpSrv.Close()
+	}
+
+	return nil
+}
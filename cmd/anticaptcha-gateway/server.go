@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sintanial/go-anticaptcha"
+)
+
+const maxRequestSize = 10 << 20
+
+var errShuttingDown = errors.New("shutting down")
+
+// solveFunc solves one attempt of a task.
+type solveFunc func(ctx context.Context) (interface{}, *anticaptcha.TaskResult, error)
+
+// server serves the gateway api. Tasks are solved in the background with
+// ctx, retryable errors are retried Retries times.
+type server struct {
+	ac         *anticaptcha.Anticaptcha
+	store      *store
+	logger     *slog.Logger
+	token      string
+	retries    int
+	retryDelay time.Duration
+	maxWait    time.Duration
+
+	ctx      context.Context
+	mu       sync.Mutex
+	draining bool
+	wg       sync.WaitGroup
+}
+
+func (self *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tasks", self.auth(self.handleSubmit))
+	mux.HandleFunc("/tasks/", self.auth(self.handleTask))
+	mux.HandleFunc("/balance", self.auth(self.handleBalance))
+	mux.HandleFunc("/healthz", self.handleHealth)
+	return mux
+}
+
+func (self *server) auth(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if self.token != "" && r.Header.Get("Authorization") != "Bearer "+self.token {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "")
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+// handleSubmit accepts a task in the anti-captcha createTask format:
+// ImageToTextTask, NoCaptchaTaskProxyless or NoCaptchaTask.
+func (self *server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed", "")
+		return
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&raw); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json: "+err.Error(), "")
+		return
+	}
+
+	taskType, solve, err := self.parseTask(raw)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+
+	t, err := self.start(taskType, solve)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error(), "")
+		return
+	}
+
+	self.logger.Info("task submitted", "task_id", t.Id, "task_type", taskType)
+
+	snapshot, _, _ := self.store.get(t.Id)
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+func (self *server) parseTask(raw json.RawMessage) (string, solveFunc, error) {
+	var header struct {
+		Type string `json:"type"`
+		Body string `json:"body"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return "", nil, err
+	}
+
+	switch header.Type {
+	case "ImageToTextTask":
+		if header.Body == "" {
+			return "", nil, errors.New("body is required")
+		}
+
+		opts := &anticaptcha.ImageToTextTask{}
+		if err := json.Unmarshal(raw, opts); err != nil {
+			return "", nil, err
+		}
+
+		return header.Type, func(ctx context.Context) (interface{}, *anticaptcha.TaskResult, error) {
+			res, err := self.ac.ImageToTextResolver().ResolveContext(ctx, []byte(header.Body), opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return res.Solution, &res.TaskResult, nil
+		}, nil
+	case "NoCaptchaTaskProxyless":
+		t := anticaptcha.NoCaptchaProxylessTask{}
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return "", nil, err
+		}
+		if t.WebsiteURL == "" || t.WebsiteKey == "" {
+			return "", nil, errors.New("websiteURL and websiteKey are required")
+		}
+
+		return header.Type, func(ctx context.Context) (interface{}, *anticaptcha.TaskResult, error) {
+			res, err := self.ac.NoCaptchaResolver().ResolveProxylessContext(ctx, t)
+			if err != nil {
+				return nil, nil, err
+			}
+			return res.Solution, &res.TaskResult, nil
+		}, nil
+	case "NoCaptchaTask":
+		t := anticaptcha.NoCaptchaTask{}
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return "", nil, err
+		}
+		if t.WebsiteURL == "" || t.WebsiteKey == "" || t.UserAgent == "" {
+			return "", nil, errors.New("websiteURL, websiteKey and userAgent are required")
+		}
+
+		return header.Type, func(ctx context.Context) (interface{}, *anticaptcha.TaskResult, error) {
+			res, err := self.ac.NoCaptchaResolver().ResolveContext(ctx, t)
+			if err != nil {
+				return nil, nil, err
+			}
+			return res.Solution, &res.TaskResult, nil
+		}, nil
+	}
+
+	return "", nil, errors.New("unsupported task type " + header.Type)
+}
+
+// start stores the task and solves it in the background.
+func (self *server) start(taskType string, solve solveFunc) (*task, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.draining {
+		return nil, errShuttingDown
+	}
+
+	t, err := self.store.add(taskType)
+	if err != nil {
+		return nil, err
+	}
+
+	self.wg.Add(1)
+	go self.run(t.Id, solve)
+
+	return t, nil
+}
+
+// drain refuses new tasks and waits for running ones.
+func (self *server) drain() {
+	self.mu.Lock()
+	self.draining = true
+	self.mu.Unlock()
+
+	self.wg.Wait()
+}
+
+// run solves the task, retrying errors that may succeed on another attempt.
+func (self *server) run(id string, solve solveFunc) {
+	defer self.wg.Done()
+
+	for attempt := 1; ; attempt++ {
+		self.store.update(id, func(t *task) { t.Attempts = attempt })
+
+		solution, res, err := solve(self.ctx)
+		if err == nil {
+			self.logger.Info("task solved", "task_id", id, "attempts", attempt, "cost", res.Cost)
+			self.store.finish(id, func(t *task) {
+				t.Status = statusReady
+				t.Solution = solution
+				t.Cost = res.Cost
+			})
+			return
+		}
+
+		if attempt <= self.retries && anticaptcha.IsRetryable(err) {
+			self.logger.Warn("task failed, retrying", "task_id", id, "attempt", attempt, "error", err.Error())
+
+			select {
+			case <-time.After(self.retryDelay):
+				continue
+			case <-self.ctx.Done():
+				err = self.ctx.Err()
+			}
+		}
+
+		self.logger.Error("task failed", "task_id", id, "attempts", attempt, "error", err.Error())
+		self.store.finish(id, func(t *task) {
+			t.Status = statusFailed
+			t.Error = err.Error()
+			t.ErrorCode = anticaptcha.ErrorCode(err)
+		})
+		return
+	}
+}
+
+// handleTask serves GET /tasks/{id} with the task status and
+// GET /tasks/{id}/result?wait=30s which waits for the task to finish.
+func (self *server) handleTask(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed", "")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/tasks/")
+	id := strings.TrimSuffix(path, "/result")
+	wait := id != path
+
+	t, done, ok := self.store.get(id)
+	if !ok || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, "task not found", "")
+		return
+	}
+
+	if !wait || t.Status != statusProcessing {
+		writeJSON(w, http.StatusOK, t)
+		return
+	}
+
+	timeout := self.maxWait
+	if v := r.URL.Query().Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid wait: "+err.Error(), "")
+			return
+		}
+		if d < timeout {
+			timeout = d
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+	case <-r.Context().Done():
+		return
+	}
+
+	t, _, _ = self.store.get(id)
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (self *server) handleBalance(w http.ResponseWriter, r *http.Request) {
+	var balance float64
+	var err error
+	if self.ac.Keys != nil {
+		balance, err = self.ac.Keys.Balance(r.Context(), &self.ac.Settings)
+	} else {
+		balance, err = self.ac.Balance()
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error(), anticaptcha.ErrorCode(err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]float64{"balance": balance})
+}
+
+func (self *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "ok",
+		"queue":    self.ac.QueueDepth(),
+		"inFlight": self.ac.InFlight(),
+		"tasks":    self.store.counts(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string, code string) {
+	writeJSON(w, status, struct {
+		Error     string `json:"error"`
+		ErrorCode string `json:"errorCode,omitempty"`
+	}{msg, code})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sintanial/go-anticaptcha"
+)
+
+func TestServer_SubmitAndWait(t *testing.T) {
+	creates := 0
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/createTask":
+			creates++
+			if creates == 1 {
+				w.Write([]byte(`{"errorId":2,"errorCode":"ERROR_NO_SLOT_AVAILABLE"}`))
+				return
+			}
+			w.Write([]byte(`{"errorId":0,"taskId":7}`))
+		case "/getTaskResult":
+			w.Write([]byte(`{"errorId":0,"status":"ready","solution":{"text":"y72bxc"},"cost":"0.000700"}`))
+		}
+	}))
+	defer api.Close()
+
+	srv := &server{
+		ac: anticaptcha.FromSettings(anticaptcha.Settings{
+			Key:      "key",
+			PingTime: time.Millisecond,
+			Provider: &anticaptcha.AntiCaptchaProvider{BaseURL: api.URL},
+		}),
+		store:      newStore(time.Hour),
+		logger:     slog.New(slog.NewTextHandler(ioutil.Discard, nil)),
+		retries:    1,
+		retryDelay: time.Millisecond,
+		maxWait:    time.Second,
+		ctx:        context.Background(),
+	}
+
+	gw := httptest.NewServer(srv.handler())
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/tasks", "application/json", strings.NewReader(`{"type":"ImageToTextTask","body":"aW1hZ2U=","numeric":1}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer resp.Body.Close()
+
+	var submitted task
+	if err := json.NewDecoder(resp.Body).Decode(&submitted); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusAccepted || submitted.Id == "" {
+		t.Fatalf("unexpected submit response %d %+v", resp.StatusCode, submitted)
+	}
+
+	resp, err = http.Get(gw.URL + "/tasks/" + submitted.Id + "/result?wait=1s")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		Status   string
+		Attempts int
+		Solution anticaptcha.ImageToTextSolution
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if res.Status != statusReady || res.Attempts != 2 || res.Solution.Text != "y72bxc" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+}
+
+func TestServer_Keys(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Key string `json:"clientKey"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		switch r.URL.Path {
+		case "/getBalance":
+			if req.Key == "a" {
+				w.Write([]byte(`{"errorId":0,"balance":1}`))
+				return
+			}
+			w.Write([]byte(`{"errorId":0,"balance":2}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer api.Close()
+
+	t.Setenv("ANTICAPTCHA_KEY", "")
+	t.Setenv("ANTICAPTCHA_KEYS", "a,b")
+
+	cfg := &config{provider: "anticaptcha", budget: anticaptcha.Budget{MinBalance: 5}}
+	logger := slog.New(slog.NewTextHandler(ioutil.Discard, nil))
+	settings, err := newSettings(cfg, logger)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	settings.Provider = &anticaptcha.AntiCaptchaProvider{BaseURL: api.URL}
+
+	srv := &server{
+		ac:      anticaptcha.FromSettings(settings),
+		store:   newStore(time.Hour),
+		logger:  logger,
+		maxWait: time.Second,
+		ctx:     context.Background(),
+	}
+
+	gw := httptest.NewServer(srv.handler())
+	defer gw.Close()
+
+	resp, err := http.Get(gw.URL + "/balance")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		Balance float64
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK || res.Balance != 3 {
+		t.Fatalf("unexpected balance response %d %+v", resp.StatusCode, res)
+	}
+
+	_, err = srv.ac.ImageToTextResolver().ResolveBytes([]byte("image"), nil)
+	if e, ok := err.(*anticaptcha.ErrBudgetExceeded); !ok || e.Limit != anticaptcha.BudgetBalance {
+		t.Fatalf("expected the pool balance to be checked, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const statusProcessing = "processing"
+const statusReady = "ready"
+const statusFailed = "failed"
+
+// task is a submitted task as returned by the api.
+type task struct {
+	Id         string      `json:"id"`
+	Type       string      `json:"type"`
+	Status     string      `json:"status"`
+	Solution   interface{} `json:"solution,omitempty"`
+	Cost       float64     `json:"cost,omitempty"`
+	Attempts   int         `json:"attempts"`
+	Error      string      `json:"error,omitempty"`
+	ErrorCode  string      `json:"errorCode,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+
+	done chan struct{}
+}
+
+// store keeps tasks in memory, finished tasks are dropped after ttl.
+type store struct {
+	ttl time.Duration
+
+	mu    sync.Mutex
+	tasks map[string]*task
+}
+
+func newStore(ttl time.Duration) *store {
+	return &store{ttl: ttl, tasks: map[string]*task{}}
+}
+
+func (self *store) add(taskType string) (*task, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	t := &task{
+		Id:        hex.EncodeToString(id),
+		Type:      taskType,
+		Status:    statusProcessing,
+		CreatedAt: time.Now(),
+		done:      make(chan struct{}),
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.prune()
+	self.tasks[t.Id] = t
+
+	return t, nil
+}
+
+// get returns a copy of the task and a channel closed once it is finished.
+func (self *store) get(id string) (task, <-chan struct{}, bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	t, ok := self.tasks[id]
+	if !ok {
+		return task{}, nil, false
+	}
+
+	return *t, t.done, true
+}
+
+// update changes the task under the store lock.
+func (self *store) update(id string, fn func(t *task)) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if t, ok := self.tasks[id]; ok {
+		fn(t)
+	}
+}
+
+// finish records the outcome of the task and wakes up waiters.
+func (self *store) finish(id string, fn func(t *task)) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	t, ok := self.tasks[id]
+	if !ok {
+		return
+	}
+
+	fn(t)
+	now := time.Now()
+	t.FinishedAt = &now
+	close(t.done)
+}
+
+func (self *store) counts() map[string]int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	counts := map[string]int{statusProcessing: 0, statusReady: 0, statusFailed: 0}
+	for _, t := range self.tasks {
+		counts[t.Status]++
+	}
+
+	return counts
+}
+
+func (self *store) prune() {
+	for id, t := range self.tasks {
+		if t.FinishedAt != nil && time.Since(*t.FinishedAt) > self.ttl {
+			delete(self.tasks, id)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package anticaptcha
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// FormatCookies formats cookies in the "name=value; name2=value2" form
+// tasks expect.
+func FormatCookies(cookies []*http.Cookie) string {
+	pairs := make([]string, 0, len(cookies))
+	for _, c := range cookies {
+		pairs = append(pairs, c.Name+"="+c.Value)
+	}
+
+	return strings.Join(pairs, "; ")
+}
+
+// ParseCookies parses cookies in the "name=value; name2=value2" form.
+func ParseCookies(cookies string) []*http.Cookie {
+	req := &http.Request{Header: http.Header{"Cookie": {cookies}}}
+	return req.Cookies()
+}
+
+// CookiesFromJar returns the cookies jar sends to websiteURL, formatted for
+// a task.
+func CookiesFromJar(jar http.CookieJar, websiteURL string) (string, error) {
+	u, err := url.Parse(websiteURL)
+	if err != nil {
+		return "", err
+	}
+
+	return FormatCookies(jar.Cookies(u)), nil
+}
+
+// SetJarCookies stores name/value cookies returned in a solution into jar
+// as cookies of websiteURL.
+func SetJarCookies(jar http.CookieJar, websiteURL string, cookies map[string]string) error {
+	u, err := url.Parse(websiteURL)
+	if err != nil {
+		return err
+	}
+
+	list := make([]*http.Cookie, 0, len(cookies))
+	for name, value := range cookies {
+		list = append(list, &http.Cookie{Name: name, Value: value})
+	}
+
+	jar.SetCookies(u, list)
+	return nil
+}
+
+// SetCookies sets the task cookies.
+func (self *NoCaptchaTask) SetCookies(cookies []*http.Cookie) {
+	self.Cookies = FormatCookies(cookies)
+}
+
+// SetCookiesFromJar sets the task cookies to the ones jar has for
+// WebsiteURL.
+func (self *NoCaptchaTask) SetCookiesFromJar(jar http.CookieJar) error {
+	cookies, err := CookiesFromJar(jar, self.WebsiteURL)
+	if err != nil {
+		return err
+	}
+
+	self.Cookies = cookies
+	return nil
+}
+
+// SaveCookies stores the cookies returned with the solution into jar as
+// cookies of websiteURL.
+func (self *NoCaptchaResult) SaveCookies(jar http.CookieJar, websiteURL string) error {
+	return SetJarCookies(jar, websiteURL, self.Solution.Cookies)
+}
@@ -0,0 +1,45 @@
+package anticaptcha
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"testing"
+)
+
+func TestNoCaptchaTask_SetCookiesFromJar(t *testing.T) {
+	jar, _ := cookiejar.New(nil)
+	u, _ := url.Parse("https://example.com/login")
+	jar.SetCookies(u, []*http.Cookie{{Name: "session", Value: "abc"}, {Name: "lang", Value: "en"}})
+
+	task := NoCaptchaTask{NoCaptchaProxylessTask: NoCaptchaProxylessTask{WebsiteURL: "https://example.com/login"}}
+	if err := task.SetCookiesFromJar(jar); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if task.Cookies != "session=abc; lang=en" {
+		t.Fatalf("unexpected cookies %q", task.Cookies)
+	}
+
+	if cookies := ParseCookies(task.Cookies); len(cookies) != 2 || cookies[1].Value != "en" {
+		t.Fatalf("unexpected parsed cookies %v", cookies)
+	}
+
+	res := &NoCaptchaResult{Solution: NoCaptchaSolution{Cookies: map[string]string{"cf_clearance": "xyz"}}}
+	if err := res.SaveCookies(jar, "https://example.com/"); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if cookies, _ := CookiesFromJar(jar, "https://example.com/"); cookies != "session=abc; lang=en; cf_clearance=xyz" {
+		t.Fatalf("unexpected jar cookies %q", cookies)
+	}
+}
+
+func TestNoCaptchaTask_SetCookiesFromJarBadURL(t *testing.T) {
+	jar, _ := cookiejar.New(nil)
+
+	task := NoCaptchaTask{NoCaptchaProxylessTask: NoCaptchaProxylessTask{WebsiteURL: "://example.com"}}
+	if err := task.SetCookiesFromJar(jar); err == nil {
+		t.Fatal("expected an error for a malformed url")
+	}
+}
@@ -0,0 +1,255 @@
+// Package detect finds captchas in html pages and extracts what is needed
+// to solve them.
+package detect
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/sintanial/go-anticaptcha"
+	"golang.org/x/net/html"
+)
+
+const RecaptchaV2 = "recaptcha-v2"
+const RecaptchaV3 = "recaptcha-v3"
+const HCaptcha = "hcaptcha"
+const Turnstile = "turnstile"
+const FunCaptcha = "funcaptcha"
+const GeeTest = "geetest"
+
+// Candidate is a captcha found in a page. Task is a task ready for the
+// anticaptcha resolvers. Only reCAPTCHA v2 without Enterprise has a task in
+// the library, for the other captchas Task is nil and Err is an
+// *ErrUnsupported.
+type Candidate struct {
+	Type       string
+	WebsiteURL string
+	WebsiteKey string
+	// SToken is the data-s parameter of reCAPTCHA.
+	SToken     string
+	Invisible  bool
+	Enterprise bool
+	// Action is the reCAPTCHA v3 or Turnstile action.
+	Action string
+	// CData is the Turnstile data-cdata parameter.
+	CData string
+	// Challenge is the GeeTest challenge.
+	Challenge string
+	Task      interface{}
+	Err       error
+}
+
+// ErrUnsupported is the error of candidates the library has no task for.
+type ErrUnsupported struct {
+	Type       string
+	Enterprise bool
+}
+
+func (self *ErrUnsupported) Error() string {
+	if self.Enterprise {
+		return "detect: no task for " + self.Type + " enterprise captchas"
+	}
+
+	return "detect: no task for " + self.Type + " captchas"
+}
+
+var (
+	reExecute   = regexp.MustCompile(`grecaptcha(?:\.enterprise)?\.execute\(\s*['"]([\w-]{20,})['"]\s*(?:,\s*\{\s*action\s*:\s*['"]([^'"]+)['"])?`)
+	reGeeTestGt = regexp.MustCompile(`["']?\bgt["']?\s*[:=]\s*["']([0-9a-f]{32})["']`)
+	reGeeTestCh = regexp.MustCompile(`["']?\bchallenge["']?\s*[:=]\s*["']([0-9a-f]{32,})["']`)
+	reArkoseKey = regexp.MustCompile(`/v2/([0-9A-F]{8}-[0-9A-F]{4}-[0-9A-F]{4}-[0-9A-F]{4}-[0-9A-F]{12})/api\.js`)
+)
+
+// DetectResponse reads the page from resp and detects its captchas, the
+// page url is taken from resp.Request.
+func DetectResponse(resp *http.Response) ([]Candidate, error) {
+	pageURL := ""
+	if resp.Request != nil && resp.Request.URL != nil {
+		pageURL = resp.Request.URL.String()
+	}
+
+	return Detect(resp.Body, pageURL)
+}
+
+// Detect parses the html page and returns the captchas found in it.
+func Detect(r io.Reader, pageURL string) ([]Candidate, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &detector{pageURL: pageURL}
+	d.walk(doc)
+	d.finish()
+
+	return d.found, nil
+}
+
+type detector struct {
+	pageURL    string
+	found      []Candidate
+	enterprise bool
+	scripts    []string
+}
+
+// add records c or completes an already found candidate with its details.
+func (self *detector) add(c Candidate) {
+	for i := range self.found {
+		f := &self.found[i]
+		if f.Type != c.Type || f.WebsiteKey != c.WebsiteKey {
+			continue
+		}
+
+		if f.Action == "" {
+			f.Action = c.Action
+		}
+		if f.SToken == "" {
+			f.SToken = c.SToken
+		}
+		if f.Challenge == "" {
+			f.Challenge = c.Challenge
+		}
+		f.Invisible = f.Invisible || c.Invisible
+		f.Enterprise = f.Enterprise || c.Enterprise
+		return
+	}
+
+	c.WebsiteURL = self.pageURL
+	self.found = append(self.found, c)
+}
+
+func (self *detector) walk(n *html.Node) {
+	if n.Type == html.ElementNode {
+		self.element(n)
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		self.walk(c)
+	}
+}
+
+func (self *detector) element(n *html.Node) {
+	attrs := make(map[string]string, len(n.Attr))
+	for _, a := range n.Attr {
+		attrs[a.Key] = a.Val
+	}
+	classes := " " + attrs["class"] + " "
+
+	switch {
+	case strings.Contains(classes, " g-recaptcha ") && attrs["data-sitekey"] != "":
+		self.add(Candidate{
+			Type:       RecaptchaV2,
+			WebsiteKey: attrs["data-sitekey"],
+			SToken:     attrs["data-s"],
+			Invisible:  attrs["data-size"] == "invisible",
+		})
+	case strings.Contains(classes, " h-captcha ") && attrs["data-sitekey"] != "":
+		self.add(Candidate{
+			Type:       HCaptcha,
+			WebsiteKey: attrs["data-sitekey"],
+			Invisible:  attrs["data-size"] == "invisible",
+		})
+	case strings.Contains(classes, " cf-turnstile ") && attrs["data-sitekey"] != "":
+		self.add(Candidate{
+			Type:       Turnstile,
+			WebsiteKey: attrs["data-sitekey"],
+			Action:     attrs["data-action"],
+			CData:      attrs["data-cdata"],
+		})
+	case attrs["data-pkey"] != "":
+		self.add(Candidate{Type: FunCaptcha, WebsiteKey: attrs["data-pkey"]})
+	}
+
+	switch n.Data {
+	case "script":
+		if src := attrs["src"]; src != "" {
+			self.scriptSrc(src)
+		} else if n.FirstChild != nil {
+			self.scripts = append(self.scripts, n.FirstChild.Data)
+		}
+	case "iframe":
+		self.iframeSrc(attrs["src"])
+	}
+}
+
+func (self *detector) scriptSrc(src string) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case strings.Contains(u.Path, "/recaptcha/enterprise.js"):
+		self.enterprise = true
+		fallthrough
+	case strings.Contains(u.Path, "/recaptcha/api.js"):
+		if key := u.Query().Get("render"); key != "" && key != "explicit" {
+			self.add(Candidate{Type: RecaptchaV3, WebsiteKey: key})
+		}
+	case strings.Contains(u.Host, "arkoselabs.com") || strings.Contains(u.Host, "funcaptcha.com"):
+		if m := reArkoseKey.FindStringSubmatch(u.Path); m != nil {
+			self.add(Candidate{Type: FunCaptcha, WebsiteKey: m[1]})
+		}
+	}
+}
+
+func (self *detector) iframeSrc(src string) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case strings.Contains(u.Path, "/recaptcha/api2/anchor") || strings.Contains(u.Path, "/recaptcha/enterprise/anchor"):
+		if key := u.Query().Get("k"); key != "" {
+			self.add(Candidate{
+				Type:       RecaptchaV2,
+				WebsiteKey: key,
+				Invisible:  u.Query().Get("size") == "invisible",
+				Enterprise: strings.Contains(u.Path, "/enterprise/"),
+			})
+		}
+	case strings.Contains(u.Host, "hcaptcha.com"):
+		// the widget passes its parameters in the fragment
+		if values, err := url.ParseQuery(u.Fragment); err == nil && values.Get("sitekey") != "" {
+			self.add(Candidate{Type: HCaptcha, WebsiteKey: values.Get("sitekey")})
+		}
+	}
+}
+
+// finish looks into inline scripts and fills the tasks.
+func (self *detector) finish() {
+	for _, script := range self.scripts {
+		for _, m := range reExecute.FindAllStringSubmatch(script, -1) {
+			self.add(Candidate{Type: RecaptchaV3, WebsiteKey: m[1], Action: m[2]})
+		}
+
+		if gt := reGeeTestGt.FindStringSubmatch(script); gt != nil {
+			c := Candidate{Type: GeeTest, WebsiteKey: gt[1]}
+			if ch := reGeeTestCh.FindStringSubmatch(script); ch != nil {
+				c.Challenge = ch[1]
+			}
+			self.add(c)
+		}
+	}
+
+	for i := range self.found {
+		c := &self.found[i]
+		if c.Type == RecaptchaV2 || c.Type == RecaptchaV3 {
+			c.Enterprise = c.Enterprise || self.enterprise
+		}
+
+		if c.Type == RecaptchaV2 && !c.Enterprise {
+			c.Task = anticaptcha.NoCaptchaProxylessTask{
+				WebsiteURL:    c.WebsiteURL,
+				WebsiteKey:    c.WebsiteKey,
+				WebsiteSToken: c.SToken,
+			}
+		} else {
+			c.Err = &ErrUnsupported{c.Type, c.Enterprise}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package detect
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sintanial/go-anticaptcha"
+)
+
+const page = `<html><head>
+<script src="https://www.google.com/recaptcha/api.js?render=6LcR_okUAAAAAPYrPe-HK_0RULO1aZM15ENyM-Mf"></script>
+<script src="https://js.hcaptcha.com/1/api.js" async defer></script>
+<script>
+grecaptcha.ready(function() {
+	grecaptcha.execute('6LcR_okUAAAAAPYrPe-HK_0RULO1aZM15ENyM-Mf', {action: 'login'});
+});
+initGeetest({gt: "022397c99c9f646f6477822485f30404", challenge: "a66f31a53a6fb2d3fd1f5b64e0c3f64a"});
+</script>
+</head><body>
+<form>
+<div class="g-recaptcha" data-sitekey="6Le-wvkSAAAAAPBMRTvw0Q4Muexq9bi0DJwx_mJ-" data-s="stoken"></div>
+<div class="h-captcha" data-sitekey="10000000-ffff-ffff-ffff-000000000001"></div>
+<div class="cf-turnstile" data-sitekey="0x4AAAAAAAAjq6WYeRDKmebM" data-action="signup"></div>
+<script src="https://client-api.arkoselabs.com/v2/69A21A01-CC7B-B9C6-0F9A-E7FA06677FFC/api.js"></script>
+</form>
+</body></html>`
+
+func TestDetect(t *testing.T) {
+	found, err := Detect(strings.NewReader(page), "https://example.com/login")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	want := map[string]string{
+		RecaptchaV3: "6LcR_okUAAAAAPYrPe-HK_0RULO1aZM15ENyM-Mf",
+		RecaptchaV2: "6Le-wvkSAAAAAPBMRTvw0Q4Muexq9bi0DJwx_mJ-",
+		HCaptcha:    "10000000-ffff-ffff-ffff-000000000001",
+		Turnstile:   "0x4AAAAAAAAjq6WYeRDKmebM",
+		FunCaptcha:  "69A21A01-CC7B-B9C6-0F9A-E7FA06677FFC",
+		GeeTest:     "022397c99c9f646f6477822485f30404",
+	}
+
+	if len(found) != len(want) {
+		t.Fatalf("expected %d candidates, got %+v", len(want), found)
+	}
+
+	for _, c := range found {
+		if want[c.Type] != c.WebsiteKey || c.WebsiteURL != "https://example.com/login" {
+			t.Errorf("unexpected candidate %+v", c)
+		}
+
+		if c.Type != RecaptchaV2 {
+			if e, ok := c.Err.(*ErrUnsupported); !ok || e.Type != c.Type || c.Task != nil {
+				t.Errorf("expected unsupported error for %s, got %v", c.Type, c.Err)
+			}
+		}
+
+		switch c.Type {
+		case RecaptchaV2:
+			task, ok := c.Task.(anticaptcha.NoCaptchaProxylessTask)
+			if !ok || task.WebsiteSToken != "stoken" || task.WebsiteURL != c.WebsiteURL {
+				t.Errorf("unexpected task %+v", c.Task)
+			}
+		case RecaptchaV3:
+			if c.Action != "login" {
+				t.Errorf("expected login action, got %q", c.Action)
+			}
+		case GeeTest:
+			if c.Challenge != "a66f31a53a6fb2d3fd1f5b64e0c3f64a" {
+				t.Errorf("unexpected challenge %q", c.Challenge)
+			}
+		}
+	}
+}
+
+func TestForm_SetToken(t *testing.T) {
+	forms, err := ParseForms(strings.NewReader(page), "https://example.com/login")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	form := FindForm(forms, HCaptcha)
+	if form == nil {
+		t.Fatal("form with hcaptcha not found")
+	}
+
+	if err := form.SetToken(HCaptcha, "token"); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	req, err := form.Request()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if req.Method != "GET" || req.URL.Query().Get("h-captcha-response") != "token" || req.URL.Host != "example.com" {
+		t.Fatalf("unexpected request %s %s", req.Method, req.URL)
+	}
+}
+
+func TestDetect_Enterprise(t *testing.T) {
+	found, err := Detect(strings.NewReader(`<script src="https://www.google.com/recaptcha/enterprise.js"></script>
+<iframe src="https://www.google.com/recaptcha/enterprise/anchor?k=6Le-wvkSAAAAAPBMRTvw0Q4Muexq9bi0DJwx_mJ-"></iframe>`), "https://example.com/")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(found) != 1 || found[0].Task != nil {
+		t.Fatalf("unexpected candidates %+v", found)
+	}
+
+	if e, ok := found[0].Err.(*ErrUnsupported); !ok || !e.Enterprise {
+		t.Fatalf("expected unsupported enterprise error, got %v", found[0].Err)
+	}
+}
@@ -0,0 +1,238 @@
+package detect
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-errors/errors"
+	"golang.org/x/net/html"
+)
+
+var ErrNoTokenField = errors.New("detect: captcha type has no token field")
+
+// TokenFields are the form fields the token of each captcha type is posted
+// in. hCaptcha fills g-recaptcha-response too for sites migrated from
+// reCAPTCHA.
+var TokenFields = map[string][]string{
+	RecaptchaV2: {"g-recaptcha-response"},
+	RecaptchaV3: {"g-recaptcha-response"},
+	HCaptcha:    {"h-captcha-response", "g-recaptcha-response"},
+	Turnstile:   {"cf-turnstile-response"},
+	FunCaptcha:  {"fc-token"},
+}
+
+// SetToken puts the solved token of captchaType into values.
+func SetToken(values url.Values, captchaType string, token string) error {
+	fields, ok := TokenFields[captchaType]
+	if !ok {
+		return ErrNoTokenField
+	}
+
+	for _, field := range fields {
+		values.Set(field, token)
+	}
+
+	return nil
+}
+
+// Form is a html form with the values a browser would submit. Captchas
+// lists the types of captcha widgets inside the form.
+type Form struct {
+	Action   string
+	Method   string
+	Values   url.Values
+	Captchas []string
+}
+
+// SetToken puts the solved token of captchaType into the form values.
+func (self *Form) SetToken(captchaType string, token string) error {
+	return SetToken(self.Values, captchaType, token)
+}
+
+// Request returns the request submitting the form.
+func (self *Form) Request() (*http.Request, error) {
+	if self.Method == http.MethodGet {
+		u, err := url.Parse(self.Action)
+		if err != nil {
+			return nil, err
+		}
+		u.RawQuery = self.Values.Encode()
+
+		return http.NewRequest(http.MethodGet, u.String(), nil)
+	}
+
+	req, err := http.NewRequest(self.Method, self.Action, strings.NewReader(self.Values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return req, nil
+}
+
+// ParseForms returns the forms of the html page, actions are resolved
+// against pageURL.
+func ParseForms(r io.Reader, pageURL string) ([]*Form, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var forms []*Form
+	var walk func(n *html.Node, form *Form)
+	walk = func(n *html.Node, form *Form) {
+		if n.Type == html.ElementNode {
+			if n.Data == "form" {
+				form = newForm(n, base)
+				forms = append(forms, form)
+			} else if form != nil {
+				formField(n, form)
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, form)
+		}
+	}
+	walk(doc, nil)
+
+	return forms, nil
+}
+
+// FindForm returns the first form of the page that contains a captcha of
+// captchaType, or nil.
+func FindForm(forms []*Form, captchaType string) *Form {
+	for _, f := range forms {
+		for _, t := range f.Captchas {
+			if t == captchaType {
+				return f
+			}
+		}
+	}
+
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	value, _ := findAttr(n, key)
+	return value
+}
+
+func newForm(n *html.Node, base *url.URL) *Form {
+	form := &Form{
+		Action: base.String(),
+		Method: strings.ToUpper(attr(n, "method")),
+		Values: url.Values{},
+	}
+
+	if form.Method != http.MethodPost {
+		form.Method = http.MethodGet
+	}
+
+	if action := attr(n, "action"); action != "" {
+		if u, err := base.Parse(action); err == nil {
+			form.Action = u.String()
+		}
+	}
+
+	return form
+}
+
+func formField(n *html.Node, form *Form) {
+	classes := " " + attr(n, "class") + " "
+	switch {
+	case strings.Contains(classes, " g-recaptcha "):
+		form.Captchas = append(form.Captchas, RecaptchaV2)
+	case strings.Contains(classes, " h-captcha "):
+		form.Captchas = append(form.Captchas, HCaptcha)
+	case strings.Contains(classes, " cf-turnstile "):
+		form.Captchas = append(form.Captchas, Turnstile)
+	}
+
+	name := attr(n, "name")
+	if name == "" {
+		return
+	}
+
+	switch n.Data {
+	case "input":
+		switch strings.ToLower(attr(n, "type")) {
+		case "submit", "button", "image", "reset", "file":
+			return
+		case "checkbox", "radio":
+			if _, checked := findAttr(n, "checked"); !checked {
+				return
+			}
+			if _, ok := findAttr(n, "value"); !ok {
+				form.Values.Add(name, "on")
+				return
+			}
+		}
+		form.Values.Add(name, attr(n, "value"))
+	case "textarea":
+		text := ""
+		if n.FirstChild != nil {
+			text = n.FirstChild.Data
+		}
+		form.Values.Add(name, text)
+	case "select":
+		if value, ok := selectedOption(n); ok {
+			form.Values.Add(name, value)
+		}
+	}
+}
+
+func findAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+
+	return "", false
+}
+
+// selectedOption returns the value of the selected option, or of the first
+// one when none is selected.
+func selectedOption(n *html.Node) (string, bool) {
+	var first *html.Node
+	var selected *html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "option" {
+			if first == nil {
+				first = n
+			}
+			if _, ok := findAttr(n, "selected"); ok && selected == nil {
+				selected = n
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+
+	if selected == nil {
+		selected = first
+	}
+	if selected == nil {
+		return "", false
+	}
+
+	if value, ok := findAttr(selected, "value"); ok {
+		return value, true
+	}
+	if selected.FirstChild != nil {
+		return strings.TrimSpace(selected.FirstChild.Data), true
+	}
+
+	return "", true
+}
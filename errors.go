@@ -2,6 +2,7 @@ package anticaptcha
 
 import (
 	"github.com/go-errors/errors"
+	"net"
 	"strconv"
 )
 
@@ -15,6 +16,71 @@ func (self *ErrAntiCaptcha) Error() string {
 	return "code(" + strconv.Itoa(self.Id) + ":" + self.Code + ") -  " + self.Message
 }
 
+const ErrorKeyDoesNotExist = "ERROR_KEY_DOES_NOT_EXIST"
+const ErrorZeroBalance = "ERROR_ZERO_BALANCE"
+const ErrorIpNotAllowed = "ERROR_IP_NOT_ALLOWED"
+const ErrorNoSlotAvailable = "ERROR_NO_SLOT_AVAILABLE"
+const ErrorCaptchaUnsolvable = "ERROR_CAPTCHA_UNSOLVABLE"
+const ErrorIpBlocked = "ERROR_IP_BLOCKED"
+const ErrorZeroCaptchaFilesize = "ERROR_ZERO_CAPTCHA_FILESIZE"
+const ErrorTooBigCaptchaFilesize = "ERROR_TOO_BIG_CAPTCHA_FILESIZE"
+
 var ErrCaptchaInProcess = errors.New("captcha in processing")
 var ErrAttemptsExceed = errors.New("captcha attempts exceed")
 var ErrCheckTimeout = errors.New("captcha check timeout")
+var ErrUnknownQueue = errors.New("no queue for task type")
+var ErrNoHealthyKey = errors.New("no healthy key in pool")
+var ErrNoProxy = errors.New("no proxy configured")
+var ErrProxyType = errors.New("proxy type must be http, https, socks4 or socks5")
+var ErrProxyAddress = errors.New("invalid proxy address")
+var ErrProxyPort = errors.New("proxy port must be between 1 and 65535")
+var ErrProxyPrivate = errors.New("proxy address is not public")
+var ErrTaskNotSupported = errors.New("task type not supported by provider")
+var ErrMethodNotSupported = errors.New("method not supported by provider")
+var ErrImagePixels = errors.New("image has too many pixels to preprocess")
+
+const BudgetHourly = "hourly"
+const BudgetDaily = "daily"
+const BudgetBalance = "balance"
+
+// ErrBudgetExceeded is returned instead of creating a task when one of the
+// Budget limits is crossed. Limit is one of BudgetHourly, BudgetDaily or
+// BudgetBalance, Value is the current spend or balance.
+type ErrBudgetExceeded struct {
+	Limit     string
+	Value     float64
+	Threshold float64
+}
+
+func (self *ErrBudgetExceeded) Error() string {
+	return "budget exceeded(" + self.Limit + ") - " + strconv.FormatFloat(self.Value, 'f', -1, 64) + " of " + strconv.FormatFloat(self.Threshold, 'f', -1, 64)
+}
+
+// IsRetryable reports whether a task failed with err may succeed with another
+// provider or key: network errors, missing slots, account problems and
+// unsolvable captchas.
+func IsRetryable(err error) bool {
+	if err == nil || err == ErrCaptchaInProcess {
+		return false
+	}
+
+	if err == ErrTaskNotSupported {
+		return true
+	}
+
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+
+	aerr, ok := err.(*ErrAntiCaptcha)
+	if !ok {
+		return false
+	}
+
+	switch aerr.Code {
+	case ErrorKeyDoesNotExist, ErrorZeroBalance, ErrorIpNotAllowed, ErrorNoSlotAvailable, ErrorCaptchaUnsolvable, ErrorIpBlocked:
+		return true
+	}
+
+	return false
+}
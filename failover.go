@@ -0,0 +1,251 @@
+package anticaptcha
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Backend is a provider and the key tasks are created with, an empty Key
+// means Settings.Key.
+type Backend struct {
+	Name     string
+	Provider Provider
+	Key      string
+}
+
+// Failover is a Provider that creates tasks with Backends in order and moves
+// on to the next backend when a task fails with a retryable error (see
+// IsRetryable). With HedgeDelay set it races: a task that is not solved
+// after HedgeDelay is also created with the next backend and the first
+// answer wins. TaskResult.Backend names the winner and TaskResult.Cost sums
+// the costs of the winner and of racing tasks that were solved by then.
+// Racing tasks still in progress are polled in the background and their cost
+// is added to Settings.Budget once they finish.
+//
+// Task ids are only valid in memory, they are not saved to Settings.Tasks
+// and can not be recovered. Solved tasks can be reported incorrect for an
+// hour, the last 1000 of them are kept.
+type Failover struct {
+	Backends   []Backend
+	HedgeDelay time.Duration
+
+	mu     sync.Mutex
+	seq    int
+	tasks  map[string]*failoverTask
+	solved []string
+}
+
+const failoverTaskTTL = time.Hour
+const failoverSolvedTasks = 1000
+const failoverSettleTimeout = 10 * time.Minute
+
+type failoverTask struct {
+	mu       sync.Mutex
+	task     Task
+	next     int
+	attempts []*failoverAttempt
+	winner   *failoverAttempt
+	created  time.Time
+	hedged   bool
+}
+
+type failoverAttempt struct {
+	backend int
+	taskId  string
+}
+
+func (self *Failover) settings(s *Settings, backend int) *Settings {
+	bs := *s
+	bs.Provider = self.Backends[backend].Provider
+	if self.Backends[backend].Key != "" {
+		bs.Key = self.Backends[backend].Key
+	}
+
+	return &bs
+}
+
+func (self *Failover) CreateTask(ctx context.Context, s *Settings, task Task) (string, error) {
+	ft := &failoverTask{task: task}
+	if err := self.createNext(ctx, s, ft); err != nil {
+		return "", err
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.tasks == nil {
+		self.tasks = make(map[string]*failoverTask)
+	}
+
+	self.prune()
+
+	self.seq++
+	id := strconv.Itoa(self.seq)
+	self.tasks[id] = ft
+
+	return id, nil
+}
+
+// createNext creates the task with the next backend that accepts it.
+func (self *Failover) createNext(ctx context.Context, s *Settings, ft *failoverTask) error {
+	err := error(ErrTaskNotSupported)
+	for ft.next < len(self.Backends) {
+		backend := ft.next
+		ft.next++
+
+		var taskId string
+		taskId, err = self.Backends[backend].Provider.CreateTask(ctx, self.settings(s, backend), ft.task)
+		if err == nil {
+			ft.attempts = append(ft.attempts, &failoverAttempt{backend, taskId})
+			ft.created = time.Now()
+			return nil
+		}
+
+		if !IsRetryable(err) {
+			return err
+		}
+
+		s.logError(ctx, slog.LevelWarn, "anticaptcha: backend failed to create task, trying next", err, "backend", self.Backends[backend].Name, "task_type", ft.task.Type)
+	}
+
+	return err
+}
+
+func (self *Failover) TaskResult(ctx context.Context, s *Settings, taskType string, taskId string) (*RawResult, error) {
+	self.mu.Lock()
+	ft, ok := self.tasks[taskId]
+	self.mu.Unlock()
+
+	if !ok {
+		return nil, &ErrAntiCaptcha{16, "ERROR_NO_SUCH_CAPCHA_ID", "Task you are requesting does not exist"}
+	}
+
+	ft.mu.Lock()
+	res, err := self.poll(ctx, s, taskType, ft)
+	ft.mu.Unlock()
+
+	if err == ErrCaptchaInProcess {
+		return res, err
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	// solved tasks are kept for ReportIncorrect
+	if err != nil {
+		delete(self.tasks, taskId)
+	} else {
+		self.solved = append(self.solved, taskId)
+	}
+	self.prune()
+
+	return res, err
+}
+
+// prune forgets tasks nobody asked the result of or reported for too long
+// and the oldest solved tasks, the caller must hold the lock.
+func (self *Failover) prune() {
+	for id, t := range self.tasks {
+		if time.Since(t.created) > failoverTaskTTL {
+			delete(self.tasks, id)
+		}
+	}
+
+	for len(self.solved) > failoverSolvedTasks {
+		delete(self.tasks, self.solved[0])
+		self.solved = self.solved[1:]
+	}
+}
+
+func (self *Failover) poll(ctx context.Context, s *Settings, taskType string, ft *failoverTask) (*RawResult, error) {
+	var lastErr error
+	var active []*failoverAttempt
+	for i, a := range ft.attempts {
+		res, err := self.Backends[a.backend].Provider.TaskResult(ctx, self.settings(s, a.backend), taskType, a.taskId)
+		if err == nil {
+			ft.winner = a
+			res.Backend = self.Backends[a.backend].Name
+			// every other attempt is charged: the ones polled before the
+			// winner were still in progress, the ones after it not polled
+			for j, other := range ft.attempts {
+				if j == i {
+					continue
+				}
+
+				ores, err := self.Backends[other.backend].Provider.TaskResult(ctx, self.settings(s, other.backend), taskType, other.taskId)
+				if err == nil {
+					res.Cost += ores.Cost
+				} else if err == ErrCaptchaInProcess {
+					go self.settle(s, taskType, other)
+				}
+			}
+			return res, nil
+		}
+
+		if err == ErrCaptchaInProcess {
+			active = append(active, a)
+			continue
+		}
+
+		if !IsRetryable(err) {
+			return nil, err
+		}
+
+		s.logError(ctx, slog.LevelWarn, "anticaptcha: backend failed to solve task, trying next", err, "backend", self.Backends[a.backend].Name, "task_type", taskType, "task_id", a.taskId)
+		lastErr = err
+	}
+	ft.attempts = active
+
+	if len(ft.attempts) == 0 {
+		if err := self.createNext(ctx, s, ft); err != nil {
+			if lastErr != nil && err == ErrTaskNotSupported {
+				return nil, lastErr
+			}
+			return nil, err
+		}
+	} else if self.HedgeDelay > 0 && !ft.hedged && time.Since(ft.created) >= self.HedgeDelay && ft.next < len(self.Backends) {
+		ft.hedged = true
+		s.log(ctx, slog.LevelInfo, "anticaptcha: task not solved in time, racing next backend", "task_type", taskType, "hedge_delay", self.HedgeDelay)
+		// the first backend keeps working if the hedge can not be created
+		self.createNext(ctx, s, ft)
+	}
+
+	return nil, ErrCaptchaInProcess
+}
+
+// settle waits for a racing task that lost and adds its cost to the budget.
+func (self *Failover) settle(s *Settings, taskType string, a *failoverAttempt) {
+	ctx, cancel := context.WithTimeout(context.Background(), failoverSettleTimeout)
+	defer cancel()
+
+	bs := self.settings(s, a.backend)
+
+	var res *RawResult
+	err := s.waitResult(ctx, func() (err error) {
+		res, err = self.Backends[a.backend].Provider.TaskResult(ctx, bs, taskType, a.taskId)
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	s.Budget.add(res.Cost)
+}
+
+// Balance returns the sum of the balances of all backends.
+func (self *Failover) Balance(ctx context.Context, s *Settings) (float64, error) {
+	var total float64
+	for i := range self.Backends {
+		balance, err := self.Backends[i].Provider.Balance(ctx, self.settings(s, i))
+		if err != nil {
+			return 0, err
+		}
+
+		total += balance
+	}
+
+	return total, nil
+}
@@ -0,0 +1,122 @@
+package anticaptcha
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeProvider struct {
+	mu        sync.Mutex
+	createErr error
+	polls     int
+	readyAt   int
+	cost      float64
+	created   int
+}
+
+func (self *fakeProvider) CreateTask(ctx context.Context, s *Settings, task Task) (string, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.createErr != nil {
+		return "", self.createErr
+	}
+
+	self.created++
+	return strconv.Itoa(self.created), nil
+}
+
+func (self *fakeProvider) TaskResult(ctx context.Context, s *Settings, taskType string, taskId string) (*RawResult, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.polls++
+	if self.readyAt == 0 || self.polls < self.readyAt {
+		return nil, ErrCaptchaInProcess
+	}
+
+	return &RawResult{TaskResult: TaskResult{Cost: self.cost}, Solution: json.RawMessage(`{"text":"answer"}`)}, nil
+}
+
+func (self *fakeProvider) pollCount() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.polls
+}
+
+func (self *fakeProvider) Balance(ctx context.Context, s *Settings) (float64, error) {
+	return 1, nil
+}
+
+func TestFailover_NoSlot(t *testing.T) {
+	ac := FromSettings(Settings{
+		PingTime: time.Millisecond,
+		Provider: &Failover{Backends: []Backend{
+			{Name: "first", Provider: &fakeProvider{createErr: &ErrAntiCaptcha{2, ErrorNoSlotAvailable, ""}}},
+			{Name: "second", Provider: &fakeProvider{readyAt: 1, cost: 0.001}},
+		}},
+	})
+
+	res, err := ac.ImageToTextResolver().ResolveBytes([]byte("image"), nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if res.Backend != "second" || res.Solution.Text != "answer" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+}
+
+func TestFailover_Race(t *testing.T) {
+	slow := &fakeProvider{}
+	ac := FromSettings(Settings{
+		PingTime: time.Millisecond,
+		Provider: &Failover{HedgeDelay: 5 * time.Millisecond, Backends: []Backend{
+			{Name: "slow", Provider: slow},
+			{Name: "fast", Provider: &fakeProvider{readyAt: 2, cost: 0.002}},
+		}},
+	})
+
+	res, err := ac.ImageToTextResolver().ResolveBytes([]byte("image"), nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if res.Backend != "fast" || res.Cost != 0.002 || slow.pollCount() == 0 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+}
+
+func TestFailover_ChargesLosingTasks(t *testing.T) {
+	budget := &Budget{}
+	ac := FromSettings(Settings{
+		PingTime: time.Millisecond,
+		Budget:   budget,
+		Provider: &Failover{HedgeDelay: 5 * time.Millisecond, Backends: []Backend{
+			{Name: "slow", Provider: &fakeProvider{readyAt: 50, cost: 0.003}},
+			{Name: "fast", Provider: &fakeProvider{readyAt: 2, cost: 0.002}},
+		}},
+	})
+
+	res, err := ac.ImageToTextResolver().ResolveBytes([]byte("image"), nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if res.Backend != "fast" || res.Cost != 0.002 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for budget.Spent() < 0.005 {
+		if time.Now().After(deadline) {
+			t.Fatalf("losing task was not charged, spent %v", budget.Spent())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
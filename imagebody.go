@@ -0,0 +1,240 @@
+package anticaptcha
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const imagePlaceholder = "anticaptcha:image"
+
+// imageBody is the image of an ImageToTextTask, either base64 data or a
+// source that is base64 encoded while the request is sent. The source is
+// read from the start for every request so the task can be created again.
+type imageBody struct {
+	data string
+	src  *imageSource
+}
+
+// imageSource is a seekable reader or a file, which is only open while the
+// image is read.
+type imageSource struct {
+	mu    sync.Mutex
+	r     io.ReadSeeker
+	path  string
+	start int64
+	size  int64
+}
+
+func newImageSource(r io.ReadSeeker) (*imageSource, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	return &imageSource{r: r, start: start, size: end - start}, nil
+}
+
+func newFileImageSource(path string) (*imageSource, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &imageSource{path: path, size: info.Size()}, nil
+}
+
+// copyTo writes the image to w.
+func (self *imageSource) copyTo(w io.Writer) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	r := self.r
+	if self.path != "" {
+		f, err := os.Open(self.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if _, err := r.Seek(self.start, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err := io.CopyN(w, r, self.size)
+	return err
+}
+
+// read returns the whole image.
+func (self *imageSource) read() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(int(self.size))
+	if err := self.copyTo(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// size returns the decoded size of the image, base64 data is expected
+// without line breaks.
+func (self imageBody) size() int64 {
+	if self.src != nil {
+		return self.src.size
+	}
+
+	n := len(self.data)
+	if n%4 != 0 {
+		return int64(base64.RawStdEncoding.DecodedLen(n))
+	}
+
+	return int64(n/4*3 - (n - len(strings.TrimRight(self.data, "="))))
+}
+
+// check refuses empty images and images larger than max before a task is
+// created.
+func (self imageBody) check(max int64) error {
+	size := self.size()
+	if size == 0 {
+		return &ErrAntiCaptcha{3, ErrorZeroCaptchaFilesize, "captcha image is empty"}
+	}
+
+	if max > 0 && size > max {
+		return &ErrAntiCaptcha{4, ErrorTooBigCaptchaFilesize, "captcha image is larger than " + strconv.FormatInt(max, 10) + " bytes"}
+	}
+
+	return nil
+}
+
+// encodedLen returns the length of the base64 image.
+func (self imageBody) encodedLen() int64 {
+	if self.src != nil {
+		return int64(base64.StdEncoding.EncodedLen(int(self.src.size)))
+	}
+
+	return int64(len(self.data))
+}
+
+// writeTo writes the base64 image to w.
+func (self imageBody) writeTo(w io.Writer) error {
+	if self.src == nil {
+		_, err := io.WriteString(w, self.data)
+		return err
+	}
+
+	enc := base64.NewEncoder(base64.StdEncoding, w)
+	if err := self.src.copyTo(enc); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+// encode returns the base64 image.
+func (self imageBody) encode() (string, error) {
+	if self.src == nil {
+		return self.data, nil
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(int(self.encodedLen()))
+	if err := self.writeTo(&buf); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func (self imageBody) MarshalJSON() ([]byte, error) {
+	if self.src == nil {
+		return json.Marshal(self.data)
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(int(self.encodedLen()) + 2)
+	buf.WriteByte('"')
+	if err := self.writeTo(&buf); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('"')
+
+	return buf.Bytes(), nil
+}
+
+// streamBody is a JSON request body with an image that is encoded while the
+// request is sent instead of being marshalled in memory.
+type streamBody struct {
+	prefix []byte
+	image  imageBody
+	suffix []byte
+}
+
+// streamOf returns the stream of a createTask body whose image is read from
+// a source, it is nil for other bodies. Middlewares see the createTask body
+// itself, the stream is only made when the request is sent.
+func streamOf(body interface{}) (*streamBody, error) {
+	reqdata, ok := body.(reqData)
+	if !ok {
+		return nil, nil
+	}
+
+	task, ok := reqdata.Task.(*imageToTextTask)
+	if !ok || task.Body.src == nil {
+		return nil, nil
+	}
+
+	return newStreamBody(reqdata, task)
+}
+
+// newStreamBody marshals reqdata, which holds task, with the image left out.
+func newStreamBody(reqdata reqData, task *imageToTextTask) (*streamBody, error) {
+	withoutImage := *task
+	withoutImage.Body = imageBody{data: imagePlaceholder}
+	reqdata.Task = &withoutImage
+
+	data, err := json.Marshal(reqdata)
+	if err != nil {
+		return nil, err
+	}
+
+	i := bytes.Index(data, []byte(`"`+imagePlaceholder+`"`))
+	return &streamBody{
+		prefix: data[:i+1],
+		image:  task.Body,
+		suffix: data[i+len(imagePlaceholder)+1:],
+	}, nil
+}
+
+func (self *streamBody) len() int64 {
+	return int64(len(self.prefix)) + self.image.encodedLen() + int64(len(self.suffix))
+}
+
+func (self *streamBody) writeTo(w io.Writer) error {
+	if _, err := w.Write(self.prefix); err != nil {
+		return err
+	}
+
+	if err := self.image.writeTo(w); err != nil {
+		return err
+	}
+
+	_, err := w.Write(self.suffix)
+	return err
+}
+
+// withoutImage returns the body with an empty image, for logging.
+func (self *streamBody) withoutImage() []byte {
+	return append(append([]byte{}, self.prefix...), self.suffix...)
+}
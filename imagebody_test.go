@@ -0,0 +1,124 @@
+package anticaptcha
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fileOpen reports whether the process holds path open, it is false where
+// /proc is missing.
+func fileOpen(path string) bool {
+	fds, _ := ioutil.ReadDir("/proc/self/fd")
+	for _, fd := range fds {
+		if target, _ := os.Readlink(filepath.Join("/proc/self/fd", fd.Name())); target == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestImageToTextResolver_ResolveFileStreams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "captcha.png")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/createTask":
+			if r.ContentLength <= 0 || len(r.TransferEncoding) > 0 {
+				t.Errorf("body is not sent with a length: %d %v", r.ContentLength, r.TransferEncoding)
+			}
+
+			var req struct {
+				Key  string `json:"clientKey"`
+				Task struct {
+					Type string `json:"type"`
+					Body string `json:"body"`
+					Case bool   `json:"case"`
+				} `json:"task"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Error(err.Error())
+			}
+			if req.Key != "key" || req.Task.Type != "ImageToTextTask" || req.Task.Body != "aW1hZ2U=" || !req.Task.Case {
+				t.Errorf("unexpected request %+v", req)
+			}
+			w.Write([]byte(`{"errorId":0,"taskId":7}`))
+		case "/getTaskResult":
+			if fileOpen(path) {
+				t.Error("image file is open while the task is polled")
+			}
+			w.Write([]byte(`{"errorId":0,"status":"ready","solution":{"text":"answer"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	if err := ioutil.WriteFile(path, []byte("image"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// middlewares see the createTask body, it is streamed after them
+	var seen []byte
+	inspect := func(next RoundTrip) RoundTrip {
+		return func(ctx context.Context, req *ApiRequest) (*ApiResponse, error) {
+			if strings.HasSuffix(req.URL, "/createTask") {
+				seen, _ = json.Marshal(req.Body)
+			}
+			return next(ctx, req)
+		}
+	}
+
+	ac := FromSettings(Settings{
+		Key:         "key",
+		PingTime:    time.Millisecond,
+		Provider:    &AntiCaptchaProvider{BaseURL: srv.URL},
+		Middlewares: []Middleware{inspect},
+	})
+
+	res, err := ac.ImageToTextResolver().ResolveFile(path, &ImageToTextTask{Case: true})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if res.Solution.Text != "answer" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	if !strings.Contains(string(seen), `"body":"aW1hZ2U="`) {
+		t.Fatalf("middleware saw %s", seen)
+	}
+}
+
+func TestImageToTextResolver_ImageSize(t *testing.T) {
+	provider := &fakeProvider{readyAt: 1}
+	ac := FromSettings(Settings{PingTime: time.Millisecond, Provider: provider, MaxImageSize: 4})
+
+	_, err := ac.ImageToTextResolver().ResolveReader(strings.NewReader(""), nil)
+	if aerr, ok := err.(*ErrAntiCaptcha); !ok || aerr.Code != ErrorZeroCaptchaFilesize {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	_, err = ac.ImageToTextResolver().ResolveReader(ioutil.NopCloser(strings.NewReader("image")), nil)
+	if aerr, ok := err.(*ErrAntiCaptcha); !ok || aerr.Code != ErrorTooBigCaptchaFilesize {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if provider.created != 0 {
+		t.Fatalf("%d tasks created for invalid images", provider.created)
+	}
+}
+
+func TestImageBody_Size(t *testing.T) {
+	for data, size := range map[string]int64{"aW1hZ2U=": 5, "aW1hZ2Vz": 6, "aW1hZw==": 4, "aW1hZw": 4} {
+		if got := (imageBody{data: data}).size(); got != size {
+			t.Errorf("size of %s is %d, expected %d", data, got, size)
+		}
+	}
+}
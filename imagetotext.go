@@ -2,29 +2,30 @@ package anticaptcha
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"io/ioutil"
-	"time"
 	"io"
-	"encoding/base64"
+	"io/ioutil"
+	"log/slog"
+	"os"
 )
 
 const NumericOnlyNumbers = 1
 const NumericNoNumbers = 2
 
 type ImageToTextTask struct {
-	Phrase     bool `json:"phrase, omitempty"`
-	Case       bool `json:"case, omitempty"`
-	Numeric    int  `json:"numeric, omitempty"`
-	Math       bool `json:"math, omitempty"`
-	MinRespLen int  `json:"minLength, omitempty"`
-	MaxRespLen int  `json:"maxLength, omitempty"`
+	Phrase     bool `json:"phrase,omitempty"`
+	Case       bool `json:"case,omitempty"`
+	Numeric    int  `json:"numeric,omitempty"`
+	Math       bool `json:"math,omitempty"`
+	MinRespLen int  `json:"minLength,omitempty"`
+	MaxRespLen int  `json:"maxLength,omitempty"`
 }
 type imageToTextTask struct {
 	ImageToTextTask
 
-	Type string `json:"type"`
-	Body string `json:"body"`
+	Type string    `json:"type"`
+	Body imageBody `json:"body"`
 }
 
 type ImageToTextResolver struct {
@@ -69,99 +70,142 @@ func (self *ImageToTextResolver) Solution(captcha []byte, opts *ImageToTextTask)
 }
 
 func (self *ImageToTextResolver) ResolveReader(r io.Reader, opts *ImageToTextTask) (*ImageToTextResult, error) {
-	data, err := ioutil.ReadAll(r)
+	return self.ResolveReaderContext(context.Background(), r, opts)
+}
+
+// ResolveReaderContext base64 encodes the image while the task is sent.
+// Readers that can not seek are copied to a temporary file first, so that
+// the task can be created again on retries.
+func (self *ImageToTextResolver) ResolveReaderContext(ctx context.Context, r io.Reader, opts *ImageToTextTask) (*ImageToTextResult, error) {
+	if rs, ok := r.(io.ReadSeeker); ok {
+		src, err := newImageSource(rs)
+		if err != nil {
+			return nil, err
+		}
+
+		return self.resolve(ctx, imageBody{src: src}, opts)
+	}
+
+	f, err := ioutil.TempFile("", "anticaptcha-image-")
 	if err != nil {
 		return nil, err
 	}
+	defer os.Remove(f.Name())
 
-	return self.ResolveBytes(data, opts)
+	// the limit is checked after preprocessing, which may shrink the image
+	limit := self.MaxImageSize
+	if self.ImagePreprocess != nil {
+		limit = self.ImagePreprocess.getMaxInputSize()
+	}
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return self.resolveFile(ctx, f.Name(), opts)
 }
 
+// ResolveFile opens the file only while the task is created.
 func (self *ImageToTextResolver) ResolveFile(f string, opts *ImageToTextTask) (*ImageToTextResult, error) {
-	data, err := ioutil.ReadFile(f)
+	return self.resolveFile(context.Background(), f, opts)
+}
+
+func (self *ImageToTextResolver) resolveFile(ctx context.Context, f string, opts *ImageToTextTask) (*ImageToTextResult, error) {
+	src, err := newFileImageSource(f)
 	if err != nil {
 		return nil, err
 	}
 
-	return self.ResolveBytes(data, opts)
+	return self.resolve(ctx, imageBody{src: src}, opts)
 }
 
 func (self *ImageToTextResolver) ResolveBytes(b []byte, opts *ImageToTextTask) (*ImageToTextResult, error) {
-	return self.Resolve([]byte(base64.StdEncoding.EncodeToString(b)), opts)
+	return self.ResolveReader(bytes.NewReader(b), opts)
 }
 
 // captcha - base64 image
 func (self *ImageToTextResolver) Resolve(captcha []byte, opts *ImageToTextTask) (*ImageToTextResult, error) {
-	taskId, err := self.CreateTask(captcha, opts)
+	return self.ResolveContext(context.Background(), captcha, opts)
+}
+
+// captcha - base64 image
+func (self *ImageToTextResolver) ResolveContext(ctx context.Context, captcha []byte, opts *ImageToTextTask) (*ImageToTextResult, error) {
+	return self.resolve(ctx, imageBody{data: string(captcha)}, opts)
+}
+
+func (self *ImageToTextResolver) resolve(ctx context.Context, body imageBody, opts *ImageToTextTask) (*ImageToTextResult, error) {
+	body, err := self.preprocess(body)
 	if err != nil {
 		return nil, err
 	}
 
-	answerch := make(chan *ImageToTextResult)
-	errch := make(chan error)
+	if err := body.check(self.MaxImageSize); err != nil {
+		return nil, err
+	}
 
-	var timer *time.Timer
-	attempts := 0
-	timer = time.AfterFunc(self.getPingTime(), func() {
-		attempts++
+	task, payload := self.task(body, opts)
 
-		answer, err := self.TaskResult(taskId)
-		if err != nil {
-			if err == ErrCaptchaInProcess {
-				if self.MaxCheckAttempts > 0 && attempts > self.MaxCheckAttempts {
-					errch <- ErrAttemptsExceed
-					return
-				} else if int64(self.MaxTimeAttempts) > 0 && attempts * int(self.getPingTime().Seconds()) > int(self.MaxTimeAttempts.Seconds()) {
-					errch <- ErrCheckTimeout
-					return
-				}
-
-				timer.Reset(self.getPingTime())
-				return
-			}
-
-			errch <- err
-			return
+	var key string
+	if self.ImageCache != nil {
+		var err error
+		if key, err = self.ImageCache.key(payload, self.getLang()); err != nil {
+			return nil, err
 		}
 
-		answerch <- answer
-	})
+		if cached, ok := self.ImageCache.get(key); ok {
+			self.log(ctx, slog.LevelDebug, "anticaptcha: image answer cached", "task_id", cached.TaskId)
+			return &ImageToTextResult{TaskResult: TaskResult{TaskId: cached.TaskId}, Solution: cached.Solution, Cached: true}, nil
+		}
+	}
 
-	select {
-	case err := <-errch:
+	raw, err := self.solve(ctx, task)
+	if err != nil {
 		return nil, err
-	case res := <-answerch:
-		return res, nil
 	}
+
+	res := &ImageToTextResult{TaskResult: raw.TaskResult}
+	if err := json.Unmarshal(raw.Solution, &res.Solution); err != nil {
+		return nil, err
+	}
+
+	self.ImageCache.set(key, res.TaskId, res.Solution)
+
+	return res, nil
 }
 
 // captcha - base64 image
 func (self *ImageToTextResolver) CreateTask(captcha []byte, opts *ImageToTextTask) (int, error) {
-	task := struct {
-		ImageToTextTask `json:"-"`
-
-		Type string `json:"type"`
-		Body string `json:"body"`
-	}{
-		Type: "ImageToTextTask",
-		Body: string(captcha),
+	body, err := self.preprocess(imageBody{data: string(captcha)})
+	if err != nil {
+		return 0, err
 	}
 
-	if opts != nil {
-		task.ImageToTextTask = *opts
+	if err := body.check(self.MaxImageSize); err != nil {
+		return 0, err
 	}
 
-	reqbody, err := json.Marshal(reqData{Key: self.Key, Task: task, Language: self.getLang()})
-	if err != nil {
-		return 0, err
+	task, _ := self.task(body, opts)
+	return self.createTask(task)
+}
+
+func (self *ImageToTextResolver) task(body imageBody, opts *ImageToTextTask) (Task, *imageToTextTask) {
+	task := &imageToTextTask{
+		Type: "ImageToTextTask",
+		Body: body,
 	}
 
-	resp, err := self.getClient().Post("http://api.anti-captcha.com/createTask", "application/json", bytes.NewReader(reqbody))
-	if err != nil {
-		return 0, err
+	if opts != nil {
+		task.ImageToTextTask = *opts
 	}
 
-	return parseTaskIdFromResp(resp)
+	return Task{task.Type, task}, task
 }
 
 type ImageToTextSolution struct {
@@ -172,47 +216,19 @@ type ImageToTextSolution struct {
 type ImageToTextResult struct {
 	TaskResult
 	Solution ImageToTextSolution `json:"solution"`
+	// Cached is set when the answer came from Settings.ImageCache.
+	Cached bool `json:"-"`
 }
 
 func (self *ImageToTextResolver) TaskResult(taskId int) (*ImageToTextResult, error) {
-	reqdata := struct {
-		Key    string `json:"clientKey"`
-		TaskId int    `json:"taskId"`
-	}{self.Key, taskId}
-
-	reqbody, err := json.Marshal(reqdata)
+	res := &ImageToTextResult{}
+	tr, err := self.taskResult("ImageToTextTask", taskId, &res.Solution)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := self.getClient().Post("https://api.anti-captcha.com/getTaskResult", "application/json", bytes.NewReader(reqbody))
-	if err != nil {
-		return nil, err
-	}
-
-	respbody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var respdata struct {
-		ImageToTextResult
-		taskResult
-	}
-
-	if err := json.Unmarshal(respbody, &respdata); err != nil {
-		return nil, err
-	}
-
-	if respdata.ErrorId > 0 {
-		return nil, respdata.ToErr()
-	}
-
-	if respdata.Status == statusProcessing {
-		return nil, ErrCaptchaInProcess
-	}
-
-	return &respdata.ImageToTextResult, nil
+	res.TaskResult = *tr
+	return res, nil
 }
 
 func (self ImageToTextResolver) TaskSolution(taskId int) (string, error) {
@@ -223,3 +239,9 @@ func (self ImageToTextResolver) TaskSolution(taskId int) (string, error) {
 
 	return res.Solution.Text, nil
 }
+
+// ReportIncorrect reports the task and evicts its answer from the cache.
+func (self *ImageToTextResolver) ReportIncorrect(taskId int) error {
+	self.ImageCache.evict(taskId)
+	return self.reportIncorrect("ImageToTextTask", taskId)
+}
@@ -0,0 +1,317 @@
+package anticaptcha
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const KeysRoundRobin = "round-robin"
+const KeysLeastSpend = "least-spend"
+const KeysHighestBalance = "highest-balance"
+
+// KeyPool spreads tasks over several api keys. A key that fails with
+// ERROR_KEY_DOES_NOT_EXIST, ERROR_ZERO_BALANCE or ERROR_IP_NOT_ALLOWED is
+// not used until RetryAfter passes. Tasks are always polled with the key
+// that created them.
+type KeyPool struct {
+	Keys []string
+	// Strategy is one of the Keys* constants, KeysRoundRobin when empty.
+	Strategy       string
+	RetryAfter     time.Duration
+	BalanceRefresh time.Duration
+	// TaskTTL is how long the key of a task is kept for polling it and, after
+	// its result, for ReportIncorrect, one hour when zero.
+	TaskTTL time.Duration
+
+	mu    sync.Mutex
+	next  int
+	state map[string]*keyState
+	tasks map[string]keyTask
+}
+
+type keyTask struct {
+	key     string
+	expires time.Time
+}
+
+type keyState struct {
+	spent          float64
+	balance        float64
+	balanceAt      time.Time
+	unhealthyUntil time.Time
+	err            error
+}
+
+// KeyHealth is the state of a key in a KeyPool, Err is the error that
+// marked the key unhealthy.
+type KeyHealth struct {
+	Key            string
+	Healthy        bool
+	Spent          float64
+	Balance        float64
+	UnhealthyUntil time.Time
+	Err            error
+}
+
+func (self *KeyPool) getRetryAfter() time.Duration {
+	if int64(self.RetryAfter) == 0 {
+		return 10 * time.Minute
+	}
+
+	return self.RetryAfter
+}
+
+func (self *KeyPool) getBalanceRefresh() time.Duration {
+	if int64(self.BalanceRefresh) == 0 {
+		return 5 * time.Minute
+	}
+
+	return self.BalanceRefresh
+}
+
+func (self *KeyPool) getTaskTTL() time.Duration {
+	if int64(self.TaskTTL) == 0 {
+		return time.Hour
+	}
+
+	return self.TaskTTL
+}
+
+// the caller must hold the lock
+func (self *KeyPool) getState(key string) *keyState {
+	if self.state == nil {
+		self.state = make(map[string]*keyState)
+	}
+
+	st, ok := self.state[key]
+	if !ok {
+		st = &keyState{}
+		self.state[key] = st
+	}
+
+	return st
+}
+
+// Health returns the state of every key.
+func (self *KeyPool) Health() []KeyHealth {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	now := time.Now()
+	res := make([]KeyHealth, 0, len(self.Keys))
+	for _, key := range self.Keys {
+		st := self.getState(key)
+		res = append(res, KeyHealth{key, !now.Before(st.unhealthyUntil), st.spent, st.balance, st.unhealthyUntil, st.err})
+	}
+
+	return res
+}
+
+// MarkHealthy makes key available again before RetryAfter passes.
+func (self *KeyPool) MarkHealthy(key string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	st := self.getState(key)
+	st.unhealthyUntil = time.Time{}
+	st.err = nil
+}
+
+func (self *KeyPool) pick(ctx context.Context, s *Settings) (string, error) {
+	if self.Strategy == KeysHighestBalance {
+		self.refreshBalances(ctx, s)
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	now := time.Now()
+	best := -1
+	for i := range self.Keys {
+		idx := (self.next + i) % len(self.Keys)
+		st := self.getState(self.Keys[idx])
+		if now.Before(st.unhealthyUntil) {
+			continue
+		}
+
+		if best < 0 {
+			best = idx
+			if self.Strategy == "" || self.Strategy == KeysRoundRobin {
+				break
+			}
+			continue
+		}
+
+		bst := self.getState(self.Keys[best])
+		if (self.Strategy == KeysLeastSpend && st.spent < bst.spent) || (self.Strategy == KeysHighestBalance && st.balance > bst.balance) {
+			best = idx
+		}
+	}
+
+	if best < 0 {
+		return "", ErrNoHealthyKey
+	}
+
+	self.next = best + 1
+	return self.Keys[best], nil
+}
+
+// Balance returns the total balance of the healthy keys, balances older than
+// BalanceRefresh are loaded first. It fails when no balance is known and
+// loading one failed.
+func (self *KeyPool) Balance(ctx context.Context, s *Settings) (float64, error) {
+	err := self.refreshBalances(ctx, s)
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	var total float64
+	known := false
+	now := time.Now()
+	for _, key := range self.Keys {
+		st := self.getState(key)
+		if st.balanceAt.IsZero() || now.Before(st.unhealthyUntil) {
+			continue
+		}
+
+		total += st.balance
+		known = true
+	}
+
+	if !known && err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// refreshBalances loads the stale balances of healthy keys and returns the
+// last error.
+func (self *KeyPool) refreshBalances(ctx context.Context, s *Settings) error {
+	var lastErr error
+	for _, key := range self.Keys {
+		self.mu.Lock()
+		st := self.getState(key)
+		stale := time.Since(st.balanceAt) >= self.getBalanceRefresh() && !time.Now().Before(st.unhealthyUntil)
+		self.mu.Unlock()
+
+		if !stale {
+			continue
+		}
+
+		ks := *s
+		ks.Key = key
+		balance, err := ks.getProvider().Balance(ctx, &ks)
+		self.report(key, err)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		self.mu.Lock()
+		st.balance = balance
+		st.balanceAt = time.Now()
+		self.mu.Unlock()
+	}
+
+	return lastErr
+}
+
+// keyHash returns the fingerprint of key stored in place of the key.
+func keyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// byHash returns the key of the pool with the fingerprint hash.
+func (self *KeyPool) byHash(hash string) (string, bool) {
+	if self == nil {
+		return "", false
+	}
+
+	for _, key := range self.Keys {
+		if keyHash(key) == hash {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+// report marks key unhealthy if err says the key can not be used.
+func (self *KeyPool) report(key string, err error) {
+	if self == nil {
+		return
+	}
+
+	aerr, ok := err.(*ErrAntiCaptcha)
+	if !ok {
+		return
+	}
+
+	switch aerr.Code {
+	case ErrorKeyDoesNotExist, ErrorZeroBalance, ErrorIpNotAllowed:
+	default:
+		return
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	st := self.getState(key)
+	st.unhealthyUntil = time.Now().Add(self.getRetryAfter())
+	st.err = err
+}
+
+func (self *KeyPool) add(key string, cost float64) {
+	if self == nil {
+		return
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	st := self.getState(key)
+	st.spent += cost
+	st.balance -= cost
+}
+
+// remember stores the key of a task for polling and ReportIncorrect until
+// TaskTTL passes, it is called again once the result is known. Tasks older
+// than TaskTTL are dropped.
+func (self *KeyPool) remember(taskId string, key string) {
+	if self == nil {
+		return
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.tasks == nil {
+		self.tasks = make(map[string]keyTask)
+	}
+
+	now := time.Now()
+	for id, t := range self.tasks {
+		if now.After(t.expires) {
+			delete(self.tasks, id)
+		}
+	}
+
+	self.tasks[taskId] = keyTask{key, now.Add(self.getTaskTTL())}
+}
+
+func (self *KeyPool) keyOf(taskId string) (string, bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	t, ok := self.tasks[taskId]
+	if !ok || time.Now().After(t.expires) {
+		return "", false
+	}
+
+	return t.key, true
+}
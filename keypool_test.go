@@ -0,0 +1,151 @@
+package anticaptcha
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestKeyPool_RoundRobin(t *testing.T) {
+	pool := &KeyPool{Keys: []string{"a", "b", "c"}}
+
+	for _, want := range []string{"a", "b", "c", "a"} {
+		key, err := pool.pick(context.Background(), &Settings{})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if key != want {
+			t.Fatalf("expected key %s, got %s", want, key)
+		}
+	}
+}
+
+func TestKeyPool_Disable(t *testing.T) {
+	pool := &KeyPool{Keys: []string{"a", "b"}}
+
+	pool.report("a", &ErrAntiCaptcha{10, ErrorZeroBalance, ""})
+	pool.report("b", &ErrAntiCaptcha{2, ErrorNoSlotAvailable, ""})
+
+	for i := 0; i < 2; i++ {
+		if key, _ := pool.pick(context.Background(), &Settings{}); key != "b" {
+			t.Fatalf("expected key b, got %s", key)
+		}
+	}
+
+	pool.report("b", &ErrAntiCaptcha{1, ErrorKeyDoesNotExist, ""})
+	if _, err := pool.pick(context.Background(), &Settings{}); err != ErrNoHealthyKey {
+		t.Fatalf("expected ErrNoHealthyKey, got %v", err)
+	}
+
+	pool.MarkHealthy("a")
+	if key, _ := pool.pick(context.Background(), &Settings{}); key != "a" {
+		t.Fatalf("expected key a, got %s", key)
+	}
+}
+
+func TestKeyPool_TaskTTL(t *testing.T) {
+	pool := &KeyPool{Keys: []string{"a"}, TaskTTL: time.Millisecond}
+
+	pool.remember("1", "a")
+	if key, ok := pool.keyOf("1"); !ok || key != "a" {
+		t.Fatalf("expected key a, got %q", key)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+
+	if _, ok := pool.keyOf("1"); ok {
+		t.Fatal("expired task is still known")
+	}
+
+	pool.remember("2", "a")
+	if len(pool.tasks) != 1 {
+		t.Fatalf("expected 1 remembered task, got %d", len(pool.tasks))
+	}
+}
+
+// keyProvider records the key of every request and fails the first poll
+// with a transient error.
+type keyProvider struct {
+	fakeProvider
+
+	keys []string
+}
+
+func (self *keyProvider) CreateTask(ctx context.Context, s *Settings, task Task) (string, error) {
+	self.keys = append(self.keys, s.Key)
+	return self.fakeProvider.CreateTask(ctx, s, task)
+}
+
+func (self *keyProvider) TaskResult(ctx context.Context, s *Settings, taskType string, taskId string) (*RawResult, error) {
+	self.keys = append(self.keys, s.Key)
+	if len(self.keys) == 2 {
+		return nil, errors.New("connection reset")
+	}
+
+	return self.fakeProvider.TaskResult(ctx, s, taskType, taskId)
+}
+
+func (self *keyProvider) ReportIncorrect(ctx context.Context, s *Settings, taskType string, taskId string) error {
+	self.keys = append(self.keys, s.Key)
+	return nil
+}
+
+func TestKeyPool_TransientPoll(t *testing.T) {
+	provider := &keyProvider{fakeProvider: fakeProvider{readyAt: 1}}
+	ac := FromSettings(Settings{
+		Keys:     &KeyPool{Keys: []string{"a"}},
+		Provider: provider,
+	})
+	resolver := ac.ImageToTextResolver()
+
+	taskId, err := resolver.CreateTask([]byte("image"), nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err := resolver.TaskResult(taskId); err == nil {
+		t.Fatal("expected transient error")
+	}
+
+	if _, err := resolver.TaskResult(taskId); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err := resolver.ReportIncorrect(taskId); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for i, key := range provider.keys {
+		if key != "a" {
+			t.Fatalf("request %d used key %q", i, key)
+		}
+	}
+}
+
+func TestKeyPool_SolveReport(t *testing.T) {
+	provider := &keyProvider{fakeProvider: fakeProvider{readyAt: 1}}
+	provider.keys = []string{"", ""} // skip the transient error
+	ac := FromSettings(Settings{
+		PingTime: time.Millisecond,
+		Keys:     &KeyPool{Keys: []string{"a"}},
+		Provider: provider,
+	})
+	resolver := ac.ImageToTextResolver()
+
+	res, err := resolver.ResolveBytes([]byte("image"), nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err := resolver.ReportIncorrect(res.TaskId); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for i, key := range provider.keys[2:] {
+		if key != "a" {
+			t.Fatalf("request %d used key %q", i, key)
+		}
+	}
+}
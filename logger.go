@@ -0,0 +1,152 @@
+package anticaptcha
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Logger receives structured events of task solving and api exchanges,
+// *slog.Logger implements it. Api keys, proxy credentials, cookies and image
+// bodies are redacted unless Settings.LogSecrets is set.
+type Logger interface {
+	Log(ctx context.Context, level slog.Level, msg string, args ...interface{})
+}
+
+func (self *Settings) log(ctx context.Context, level slog.Level, msg string, args ...interface{}) {
+	if self.Logger == nil {
+		return
+	}
+
+	self.Logger.Log(ctx, level, msg, args...)
+}
+
+func (self *Settings) logError(ctx context.Context, level slog.Level, msg string, err error, args ...interface{}) {
+	if self.Logger == nil {
+		return
+	}
+
+	args = append(args, "error", err.Error())
+	if aerr, ok := err.(*ErrAntiCaptcha); ok {
+		args = append(args, "error_code", aerr.Code)
+	}
+
+	self.Logger.Log(ctx, level, msg, args...)
+}
+
+func (self *Settings) redactKey(key string) string {
+	if self.LogSecrets || key == "" {
+		return key
+	}
+
+	if len(key) <= 4 {
+		return "***"
+	}
+
+	return "***" + key[len(key)-4:]
+}
+
+// redactURLError hides the key in the query of the url a transport error
+// names.
+func (self *Settings) redactURLError(err error) error {
+	uerr, ok := err.(*url.Error)
+	if !ok || self.LogSecrets {
+		return err
+	}
+
+	u, perr := url.Parse(uerr.URL)
+	if perr != nil {
+		return err
+	}
+
+	query := u.Query()
+	key := query.Get("key")
+	if key == "" {
+		return err
+	}
+
+	query.Set("key", self.redactKey(key))
+	u.RawQuery = query.Encode()
+
+	return &url.Error{Op: uerr.Op, URL: u.String(), Err: uerr.Err}
+}
+
+// redactJSON hides the client key, proxy credentials, cookies and task bodies
+// of a request or response body, bodies that are not JSON objects are
+// returned as is.
+func (self *Settings) redactJSON(body []byte) string {
+	if self.LogSecrets {
+		return string(body)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return string(body)
+	}
+
+	self.redactFields(fields)
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return string(body)
+	}
+
+	return string(data)
+}
+
+func (self *Settings) redactFields(fields map[string]interface{}) {
+	for name, value := range fields {
+		switch name {
+		case "proxyLogin", "proxyPassword", "cookies":
+			if value != nil && value != "" {
+				fields[name] = "***"
+			}
+			continue
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			self.redactFields(v)
+		case string:
+			if name == "clientKey" || name == "key" {
+				fields[name] = self.redactKey(v)
+			} else if name == "body" {
+				fields[name] = "[" + strconv.Itoa(len(v)) + " bytes]"
+			}
+		}
+	}
+}
+
+// redactForm hides the key, proxy credentials, cookies and image body of a
+// 2captcha request.
+func (self *Settings) redactForm(form url.Values) string {
+	if self.LogSecrets {
+		return form.Encode()
+	}
+
+	redacted := url.Values{}
+	for name, values := range form {
+		redacted[name] = values
+	}
+
+	if key := form.Get("key"); key != "" {
+		redacted.Set("key", self.redactKey(key))
+	}
+
+	if proxy := form.Get("proxy"); strings.Contains(proxy, "@") {
+		redacted.Set("proxy", "***"+proxy[strings.LastIndex(proxy, "@"):])
+	}
+
+	if form.Get("cookies") != "" {
+		redacted.Set("cookies", "***")
+	}
+
+	if body := form.Get("body"); body != "" {
+		redacted.Set("body", "["+strconv.Itoa(len(body))+" bytes]")
+	}
+
+	return redacted.Encode()
+}
@@ -0,0 +1,68 @@
+package anticaptcha
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestSettings_TransportErrorRedactsKey(t *testing.T) {
+	var logs bytes.Buffer
+	ac := FromSettings(Settings{
+		Key:      "SUPERSECRETKEY",
+		PingTime: time.Millisecond,
+		Client:   &http.Client{Transport: failingTransport{}},
+		Provider: &TwoCaptchaProvider{BaseURL: "http://localhost"},
+		Logger:   slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+
+	_, err := ac.Balance()
+	if err == nil || strings.Contains(err.Error(), "SUPERSECRETKEY") || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if !IsRetryable(err) {
+		t.Fatal("redacted transport error is not retryable")
+	}
+
+	if _, err := ac.ImageToTextResolver().ResolveBytes([]byte("image"), nil); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if logs.Len() == 0 || strings.Contains(logs.String(), "SUPERSECRETKEY") {
+		t.Fatalf("key in logs: %s", logs.String())
+	}
+}
+
+func TestSettings_RedactProxyAndCookies(t *testing.T) {
+	s := &Settings{}
+
+	redacted := s.redactJSON([]byte(`{"clientKey":"SUPERSECRETKEY","task":{"proxyLogin":"user","proxyPassword":"secret","cookies":"sid=abc"},"solution":{"cookies":{"sid":"abc"}}}`))
+	for _, secret := range []string{"SUPERSECRETKEY", "user", "secret", "abc"} {
+		if strings.Contains(redacted, secret) {
+			t.Fatalf("%s in %s", secret, redacted)
+		}
+	}
+
+	form := url.Values{"key": {"SUPERSECRETKEY"}, "proxy": {"user:secret@1.2.3.4:8080"}, "cookies": {"sid:abc"}}
+	redacted = s.redactForm(form)
+	for _, secret := range []string{"SUPERSECRETKEY", "user", "secret", "abc"} {
+		if strings.Contains(redacted, secret) {
+			t.Fatalf("%s in %s", secret, redacted)
+		}
+	}
+	if !strings.Contains(redacted, "1.2.3.4") {
+		t.Fatalf("proxy address missing in %s", redacted)
+	}
+}
@@ -0,0 +1,49 @@
+package anticaptcha
+
+import (
+	"context"
+	"time"
+)
+
+// Metrics collects solving metrics, see the prometheus subpackage for a
+// ready implementation. Methods are called concurrently.
+type Metrics interface {
+	TaskCreated(taskType string)
+	TaskSolved(taskType string, duration time.Duration, polls int, cost float64)
+	// TaskFailed is called with the api error code or one of the ErrorCode*
+	// constants.
+	TaskFailed(taskType string, code string, duration time.Duration, polls int)
+	InFlight(delta int)
+	Balance(balance float64)
+}
+
+const ErrorCodeAttemptsExceed = "attempts_exceed"
+const ErrorCodeTimeout = "timeout"
+const ErrorCodeCanceled = "canceled"
+const ErrorCodeBudget = "budget"
+const ErrorCodeNetwork = "network"
+const ErrorCodeOther = "other"
+
+// ErrorCode returns the api error code of err or a short code for errors
+// that do not come from the api.
+func ErrorCode(err error) string {
+	switch e := err.(type) {
+	case *ErrAntiCaptcha:
+		return e.Code
+	case *ErrBudgetExceeded:
+		return ErrorCodeBudget
+	}
+
+	switch {
+	case err == ErrAttemptsExceed:
+		return ErrorCodeAttemptsExceed
+	case err == ErrCheckTimeout || err == context.DeadlineExceeded:
+		return ErrorCodeTimeout
+	case err == context.Canceled:
+		return ErrorCodeCanceled
+	case IsRetryable(err):
+		return ErrorCodeNetwork
+	}
+
+	return ErrorCodeOther
+}
@@ -0,0 +1,131 @@
+package anticaptcha
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeMetrics struct {
+	mu       sync.Mutex
+	created  int
+	solved   int
+	failed   []string
+	cost     float64
+	inflight int
+}
+
+func (self *fakeMetrics) TaskCreated(taskType string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.created++
+}
+
+func (self *fakeMetrics) TaskSolved(taskType string, duration time.Duration, polls int, cost float64) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.solved++
+	self.cost += cost
+}
+
+func (self *fakeMetrics) TaskFailed(taskType string, code string, duration time.Duration, polls int) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.failed = append(self.failed, code)
+}
+
+func (self *fakeMetrics) InFlight(delta int) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.inflight += delta
+}
+
+func (self *fakeMetrics) Balance(balance float64) {}
+
+func TestMetrics_Solve(t *testing.T) {
+	metrics := &fakeMetrics{}
+	ac := FromSettings(Settings{
+		PingTime: time.Millisecond,
+		Metrics:  metrics,
+		Provider: &fakeProvider{readyAt: 2, cost: 0.0007},
+	})
+
+	if _, err := ac.ImageToTextResolver().ResolveBytes([]byte("image"), nil); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if metrics.created != 1 || metrics.solved != 1 || metrics.cost != 0.0007 || metrics.inflight != 0 || len(metrics.failed) != 0 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+}
+
+func TestMetrics_CreateFailed(t *testing.T) {
+	metrics := &fakeMetrics{}
+	ac := FromSettings(Settings{
+		Metrics:  metrics,
+		Provider: &fakeProvider{createErr: &ErrAntiCaptcha{2, ErrorNoSlotAvailable, ""}},
+	})
+
+	if _, err := ac.ImageToTextResolver().ResolveBytes([]byte("image"), nil); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if metrics.created != 0 || len(metrics.failed) != 1 || metrics.failed[0] != ErrorNoSlotAvailable || metrics.inflight != 0 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+}
+
+func TestMetrics_TaskResult(t *testing.T) {
+	metrics := &fakeMetrics{}
+	ac := FromSettings(Settings{
+		Metrics:  metrics,
+		Provider: &keyProvider{fakeProvider: fakeProvider{readyAt: 2, cost: 0.0007}},
+	})
+	resolver := ac.ImageToTextResolver()
+
+	taskId, err := resolver.CreateTask([]byte("image"), nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// a transient error and a task in process are not counted
+	if _, err := resolver.TaskResult(taskId); err == nil {
+		t.Fatal("expected transient error")
+	}
+	if _, err := resolver.TaskResult(taskId); err != ErrCaptchaInProcess {
+		t.Fatalf("expected ErrCaptchaInProcess, got %v", err)
+	}
+
+	if _, err := resolver.TaskResult(taskId); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if metrics.created != 1 || metrics.solved != 1 || metrics.cost != 0.0007 || metrics.inflight != 0 || len(metrics.failed) != 0 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{&ErrAntiCaptcha{12, ErrorCaptchaUnsolvable, ""}, ErrorCaptchaUnsolvable},
+		{&ErrBudgetExceeded{BudgetDaily, 1, 1}, ErrorCodeBudget},
+		{ErrAttemptsExceed, ErrorCodeAttemptsExceed},
+		{context.DeadlineExceeded, ErrorCodeTimeout},
+		{context.Canceled, ErrorCodeCanceled},
+		{ErrNoProxy, ErrorCodeOther},
+	}
+
+	for _, test := range tests {
+		if code := ErrorCode(test.err); code != test.code {
+			t.Errorf("expected %s for %v, got %s", test.code, test.err, code)
+		}
+	}
+}
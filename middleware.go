@@ -0,0 +1,139 @@
+package anticaptcha
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ApiRequest is an api call before it is encoded. Body is marshalled to
+// JSON, or sent as a form (POST) or query (GET) when it is url.Values. An
+// image read from a reader or file is base64 encoded while the request is
+// sent, after all middlewares ran.
+type ApiRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   interface{}
+}
+
+// ApiResponse is the raw answer to an ApiRequest, it is decoded by the
+// caller of the chain.
+type ApiResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+type RoundTrip func(ctx context.Context, req *ApiRequest) (*ApiResponse, error)
+
+// Middleware wraps every api call made with the settings, middlewares may
+// change the request, answer on their own or inspect the response.
+type Middleware func(next RoundTrip) RoundTrip
+
+// SetHeader returns a middleware adding a header to every api request.
+func SetHeader(key, value string) Middleware {
+	return func(next RoundTrip) RoundTrip {
+		return func(ctx context.Context, req *ApiRequest) (*ApiResponse, error) {
+			if req.Header == nil {
+				req.Header = http.Header{}
+			}
+			req.Header.Set(key, value)
+
+			return next(ctx, req)
+		}
+	}
+}
+
+// roundTrip sends req through Middlewares, the first middleware is the
+// outermost.
+func (self *Settings) roundTrip(ctx context.Context, req *ApiRequest) (*ApiResponse, error) {
+	rt := self.send
+	for i := len(self.Middlewares) - 1; i >= 0; i-- {
+		rt = self.Middlewares[i](rt)
+	}
+
+	return rt(ctx, req)
+}
+
+// send encodes req and sends it with the http client.
+func (self *Settings) send(ctx context.Context, req *ApiRequest) (*ApiResponse, error) {
+	var body io.Reader
+	var logbody string
+	contentType := "application/json"
+	target := req.URL
+
+	stream, err := streamOf(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if form, ok := req.Body.(url.Values); ok {
+		if req.Method == http.MethodGet {
+			target += "?" + form.Encode()
+		} else {
+			body = strings.NewReader(form.Encode())
+			contentType = "application/x-www-form-urlencoded"
+		}
+		if self.Logger != nil {
+			logbody = self.redactForm(form)
+		}
+	} else if stream != nil {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(stream.writeTo(pw))
+		}()
+		body = pr
+		if self.Logger != nil {
+			logbody = self.redactJSON(stream.withoutImage())
+		}
+	} else if req.Body != nil {
+		reqbody, err := json.Marshal(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(reqbody)
+		if self.Logger != nil {
+			logbody = self.redactJSON(reqbody)
+		}
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, req.Method, target, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if stream != nil {
+		hreq.ContentLength = stream.len()
+	}
+
+	for key, values := range req.Header {
+		hreq.Header[key] = values
+	}
+	if body != nil && hreq.Header.Get("Content-Type") == "" {
+		hreq.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := self.getClient().Do(hreq)
+	if err != nil {
+		return nil, self.redactURLError(err)
+	}
+	defer resp.Body.Close()
+
+	respbody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if self.Logger != nil {
+		self.log(ctx, slog.LevelDebug, "anticaptcha: api exchange", "method", req.Method, "url", req.URL, "status", resp.StatusCode, "request", logbody, "response", self.redactJSON(respbody))
+	}
+
+	return &ApiResponse{resp.StatusCode, resp.Header, respbody}, nil
+}
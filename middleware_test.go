@@ -0,0 +1,113 @@
+package anticaptcha
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware_Order(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next RoundTrip) RoundTrip {
+			return func(ctx context.Context, req *ApiRequest) (*ApiResponse, error) {
+				calls = append(calls, name+" before")
+				resp, err := next(ctx, req)
+				calls = append(calls, name+" after")
+				return resp, err
+			}
+		}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "send")
+		w.Write([]byte(`{"errorId":0,"balance":1}`))
+	}))
+	defer srv.Close()
+
+	ac := FromSettings(Settings{
+		Key:         "key",
+		Provider:    &AntiCaptchaProvider{BaseURL: srv.URL},
+		Middlewares: []Middleware{trace("first"), trace("second")},
+	})
+
+	if _, err := ac.Balance(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := []string{"first before", "second before", "send", "second after", "first after"}
+	if len(calls) != len(expected) {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Fatalf("unexpected calls %v", calls)
+		}
+	}
+}
+
+func TestMiddleware_SetHeader(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Team") != "captcha" {
+			t.Errorf("header not set: %v", r.Header)
+		}
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected content type %s", r.Header.Get("Content-Type"))
+		}
+		w.Write([]byte(`{"errorId":0,"balance":1}`))
+	}))
+	defer srv.Close()
+
+	ac := FromSettings(Settings{
+		Key:         "key",
+		Provider:    &AntiCaptchaProvider{BaseURL: srv.URL},
+		Middlewares: []Middleware{SetHeader("X-Team", "captcha")},
+	})
+
+	if _, err := ac.Balance(); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestMiddleware_ShortCircuit(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"errorId":0,"balance":1}`))
+	}))
+	defer srv.Close()
+
+	errInjected := errors.New("injected")
+	fault := func(next RoundTrip) RoundTrip {
+		return func(ctx context.Context, req *ApiRequest) (*ApiResponse, error) {
+			return nil, errInjected
+		}
+	}
+	answer := func(next RoundTrip) RoundTrip {
+		return func(ctx context.Context, req *ApiRequest) (*ApiResponse, error) {
+			return &ApiResponse{StatusCode: http.StatusOK, Body: []byte(`{"errorId":1,"errorCode":"ERROR_KEY_DOES_NOT_EXIST"}`)}, nil
+		}
+	}
+
+	ac := FromSettings(Settings{
+		Key:         "key",
+		Provider:    &AntiCaptchaProvider{BaseURL: srv.URL},
+		Middlewares: []Middleware{fault},
+	})
+
+	if _, err := ac.Balance(); err != errInjected {
+		t.Fatalf("expected injected error, got %v", err)
+	}
+
+	ac.Middlewares = []Middleware{answer}
+	_, err := ac.Balance()
+	if aerr, ok := err.(*ErrAntiCaptcha); !ok || aerr.Code != ErrorKeyDoesNotExist {
+		t.Fatalf("expected the injected api error, got %v", err)
+	}
+
+	if requests != 0 {
+		t.Fatalf("expected no request, got %d", requests)
+	}
+}
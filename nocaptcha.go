@@ -1,15 +1,13 @@
 package anticaptcha
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"io/ioutil"
-	"time"
 )
 
 type NoCaptchaProxylessTask struct {
 	WebsiteURL    string `json:"websiteURL"`
-	WebsiteKey    string `json:"websiteKey, omitempty"`
+	WebsiteKey    string `json:"websiteKey"`
 	WebsiteSToken string `json:"websiteSToken"`
 }
 
@@ -18,61 +16,95 @@ type NoCaptchaTask struct {
 	ProxyType     string `json:"proxyType"`
 	ProxyAddress  string `json:"proxyAddress"`
 	ProxyPort     int    `json:"proxyPort"`
-	ProxyLogin    string `json:"proxyLogin, omitempty"`
-	ProxyPassword string `json:"proxyPassword, omitempty"`
+	ProxyLogin    string `json:"proxyLogin"`
+	ProxyPassword string `json:"proxyPassword"`
 	UserAgent     string `json:"userAgent"`
-	Cookies       string `json:"cookies, omitempty"`
+	Cookies       string `json:"cookies"`
+}
+
+// Proxy returns the proxy fields of the task.
+func (self *NoCaptchaTask) Proxy() Proxy {
+	return Proxy{self.ProxyType, self.ProxyAddress, self.ProxyPort, self.ProxyLogin, self.ProxyPassword}
+}
+
+// SetProxy sets the proxy fields of the task.
+func (self *NoCaptchaTask) SetProxy(p Proxy) {
+	self.ProxyType = p.ProxyType
+	self.ProxyAddress = p.ProxyAddress
+	self.ProxyPort = p.ProxyPort
+	self.ProxyLogin = p.ProxyLogin
+	self.ProxyPassword = p.ProxyPassword
 }
 
 type NoCaptchaResolver struct {
 	Settings
 }
 
+type noCaptchaProxylessTask struct {
+	NoCaptchaProxylessTask
+	Type string `json:"type"`
+}
+
+type noCaptchaTask struct {
+	NoCaptchaTask
+	Type string `json:"type"`
+}
+
 func (self *NoCaptchaResolver) CreatedProxylessTask(t NoCaptchaProxylessTask) (int, error) {
-	task := struct {
-		NoCaptchaProxylessTask
-		Type string `json:"type"`
-	}{t, "NoCaptchaTaskProxyless"}
+	return self.createTask(proxylessTask(t))
+}
 
-	reqbody, err := json.Marshal(reqData{Key: self.Key, Task: task, Language: self.getLang()})
-	if err != nil {
+func (self *NoCaptchaResolver) CreateTask(t NoCaptchaTask) (int, error) {
+	if err := self.pickProxy(&t); err != nil {
 		return 0, err
 	}
 
-	resp, err := self.getClient().Post("http://api.anti-captcha.com/createTask", "application/json", bytes.NewReader(reqbody))
+	task, err := self.proxyTask(t)
 	if err != nil {
 		return 0, err
 	}
 
-	return parseTaskIdFromResp(resp)
+	return self.createTask(task)
 }
 
-func (self *NoCaptchaResolver) CreateTask(t NoCaptchaTask) (int, error) {
-	task := struct {
-		NoCaptchaTask
-		Type string `json:"type"`
-	}{t, "NoCaptchaTask"}
+func proxylessTask(t NoCaptchaProxylessTask) Task {
+	return Task{"NoCaptchaTaskProxyless", &noCaptchaProxylessTask{t, "NoCaptchaTaskProxyless"}}
+}
 
-	reqbody, err := json.Marshal(reqData{Key: self.Key, Task: task, Language: self.getLang()})
-	if err != nil {
-		return 0, err
+// pickProxy fills an empty proxy of t from the Proxies pool.
+func (self *NoCaptchaResolver) pickProxy(t *NoCaptchaTask) error {
+	if t.ProxyAddress != "" || self.Proxies == nil {
+		return nil
 	}
 
-	resp, err := self.getClient().Post("http://api.anti-captcha.com/createTask", "application/json", bytes.NewReader(reqbody))
+	picked, err := self.Proxies.Pick()
 	if err != nil {
-		return 0, err
+		return err
+	}
+
+	t.SetProxy(picked)
+	return nil
+}
+
+func (self *NoCaptchaResolver) proxyTask(t NoCaptchaTask) (Task, error) {
+	if err := t.Proxy().Validate(self.AllowPrivateProxy); err != nil {
+		return Task{}, err
 	}
 
-	return parseTaskIdFromResp(resp)
+	return Task{"NoCaptchaTask", &noCaptchaTask{t, "NoCaptchaTask"}}, nil
 }
 
 type NoCaptchaSolution struct {
 	GRecaptchaResponse string `json:"gRecaptchaResponse"`
+	// Cookies are cookies the worker got while solving, if any.
+	Cookies map[string]string `json:"cookies"`
 }
 
 type NoCaptchaResult struct {
 	TaskResult
 	Solution NoCaptchaSolution `json:"solution"`
+	// Proxy is the proxy a proxy-on task was solved through.
+	Proxy Proxy `json:"-"`
 }
 
 func (self *NoCaptchaResolver) Solution(t NoCaptchaTask) (string, error) {
@@ -94,105 +126,62 @@ func (self *NoCaptchaResolver) SolutionProxyless(t NoCaptchaProxylessTask) (stri
 }
 
 func (self *NoCaptchaResolver) ResolveProxyless(t NoCaptchaProxylessTask) (*NoCaptchaResult, error) {
-	return self.resolve(t)
+	return self.resolve(context.Background(), proxylessTask(t))
 }
 
 func (self *NoCaptchaResolver) Resolve(t NoCaptchaTask) (*NoCaptchaResult, error) {
-	return self.resolve(t)
-}
-
-func (self *NoCaptchaResolver) resolve(t interface{}) (*NoCaptchaResult, error) {
-	var taskId int
-	var err error
-	if task, ok := t.(NoCaptchaTask); ok {
-		taskId, err = self.CreateTask(task)
-		if err != nil {
-			return nil, err
-		}
-	} else if task, ok := t.(NoCaptchaProxylessTask); ok {
-		taskId, err = self.CreatedProxylessTask(task)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	answerch := make(chan *NoCaptchaResult)
-	errch := make(chan error)
-
-	var timer *time.Timer
-	attempts := 0
-	timer = time.AfterFunc(self.getPingTime(), func() {
-		attempts++
-
-		answer, err := self.TaskResult(taskId)
-		if err != nil {
-			if err == ErrCaptchaInProcess {
-				if self.MaxCheckAttempts > 0 && attempts > self.MaxCheckAttempts {
-					errch <- ErrAttemptsExceed
-					return
-				} else if int64(self.MaxTimeAttempts) > 0 && attempts*int(self.getPingTime().Seconds()) > int(self.MaxTimeAttempts.Seconds()) {
-					errch <- ErrCheckTimeout
-					return
-				}
-
-				timer.Reset(self.getPingTime())
-				return
-			}
-
-			errch <- err
-			return
-		}
-
-		answerch <- answer
-	})
-
-	select {
-	case err := <-errch:
-		return nil, err
-	case res := <-answerch:
-		return res, nil
-	}
+	return self.ResolveContext(context.Background(), t)
 }
 
-func (self *NoCaptchaResolver) TaskResult(taskId int) (*NoCaptchaResult, error) {
-	reqdata := struct {
-		Key    string `json:"clientKey"`
-		TaskId int    `json:"taskId"`
-	}{self.Key, taskId}
+func (self *NoCaptchaResolver) ResolveProxylessContext(ctx context.Context, t NoCaptchaProxylessTask) (*NoCaptchaResult, error) {
+	return self.resolve(ctx, proxylessTask(t))
+}
 
-	reqbody, err := json.Marshal(reqdata)
-	if err != nil {
+func (self *NoCaptchaResolver) ResolveContext(ctx context.Context, t NoCaptchaTask) (*NoCaptchaResult, error) {
+	if err := self.pickProxy(&t); err != nil {
 		return nil, err
 	}
 
-	resp, err := self.getClient().Post("https://api.anti-captcha.com/getTaskResult", "application/json", bytes.NewReader(reqbody))
+	task, err := self.proxyTask(t)
 	if err != nil {
 		return nil, err
 	}
 
-	respbody, err := ioutil.ReadAll(resp.Body)
+	res, err := self.resolve(ctx, task)
+	if self.Proxies != nil {
+		self.Proxies.Report(t.Proxy(), err)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	var respdata struct {
-		NoCaptchaResult
-		taskResult
-	}
+	res.Proxy = t.Proxy()
+	return res, nil
+}
 
-	if err := json.Unmarshal(respbody, &respdata); err != nil {
+func (self *NoCaptchaResolver) resolve(ctx context.Context, task Task) (*NoCaptchaResult, error) {
+	raw, err := self.solve(ctx, task)
+	if err != nil {
 		return nil, err
 	}
 
-	if respdata.ErrorId > 0 {
-		return nil, respdata.ToErr()
+	res := &NoCaptchaResult{TaskResult: raw.TaskResult}
+	if err := json.Unmarshal(raw.Solution, &res.Solution); err != nil {
+		return nil, err
 	}
 
-	if respdata.Status == statusProcessing {
-		return nil, ErrCaptchaInProcess
+	return res, nil
+}
+
+func (self *NoCaptchaResolver) TaskResult(taskId int) (*NoCaptchaResult, error) {
+	res := &NoCaptchaResult{}
+	tr, err := self.taskResult("NoCaptchaTask", taskId, &res.Solution)
+	if err != nil {
+		return nil, err
 	}
 
-	return &respdata.NoCaptchaResult, nil
+	res.TaskResult = *tr
+	return res, nil
 }
 
 func (self NoCaptchaResolver) TaskSolution(taskId int) (string, error) {
@@ -203,3 +192,7 @@ func (self NoCaptchaResolver) TaskSolution(taskId int) (string, error) {
 
 	return res.Solution.GRecaptchaResponse, nil
 }
+
+func (self *NoCaptchaResolver) ReportIncorrect(taskId int) error {
+	return self.reportIncorrect("NoCaptchaTask", taskId)
+}
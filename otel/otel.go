@@ -0,0 +1,65 @@
+// Package otel implements anticaptcha.Tracer with OpenTelemetry.
+package otel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sintanial/go-anticaptcha"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/sintanial/go-anticaptcha"
+
+var _ anticaptcha.Tracer = (*Tracer)(nil)
+
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New returns a tracer using tp, or the global tracer provider if tp is nil.
+func New(tp trace.TracerProvider) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	return &Tracer{tp.Tracer(instrumentationName)}
+}
+
+func (self *Tracer) Start(ctx context.Context, name string) (context.Context, anticaptcha.Span) {
+	ctx, s := self.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx, span{s}
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (self span) SetAttribute(key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			self.span.SetAttributes(attribute.String(key, v))
+		}
+	case int:
+		self.span.SetAttributes(attribute.Int(key, v))
+	case float64:
+		self.span.SetAttributes(attribute.Float64(key, v))
+	case bool:
+		self.span.SetAttributes(attribute.Bool(key, v))
+	default:
+		self.span.SetAttributes(attribute.String(key, fmt.Sprint(v)))
+	}
+}
+
+func (self span) End(err error) {
+	if err != nil {
+		self.span.RecordError(err)
+		self.span.SetStatus(codes.Error, err.Error())
+	}
+
+	self.span.End()
+}
@@ -0,0 +1,44 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := New(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	_, span := tracer.Start(context.Background(), "anticaptcha.solve")
+	span.SetAttribute("anticaptcha.task_id", "7")
+	span.SetAttribute("anticaptcha.polls", 3)
+	span.SetAttribute("anticaptcha.backend", "")
+	span.End(nil)
+
+	_, span = tracer.Start(context.Background(), "anticaptcha.createTask")
+	span.End(errors.New("no slot"))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	attrs := spans[0].Attributes()
+	if len(attrs) != 2 || attrs[0] != attribute.String("anticaptcha.task_id", "7") || attrs[1] != attribute.Int("anticaptcha.polls", 3) {
+		t.Fatalf("unexpected attributes %v", attrs)
+	}
+
+	if spans[0].Status().Code != codes.Unset {
+		t.Fatalf("unexpected status %v", spans[0].Status())
+	}
+
+	if spans[1].Status().Code != codes.Error || spans[1].Status().Description != "no slot" || len(spans[1].Events()) != 1 {
+		t.Fatalf("error not recorded, status %v", spans[1].Status())
+	}
+}
@@ -0,0 +1,226 @@
+package anticaptcha
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+const ImageFormatJPEG = "jpeg"
+const ImageFormatPNG = "png"
+
+const defaultJPEGQuality = 90
+const defaultPreprocessInputSize = 20 << 20
+const defaultPreprocessPixels = 40000000
+
+// ImagePreprocess converts image captchas before they are sent. Animated
+// GIFs are reduced to their first frame. Images in formats the standard
+// library can not decode are sent as they are, the result is checked
+// against Settings.MaxImageSize.
+type ImagePreprocess struct {
+	// Format is ImageFormatJPEG or ImageFormatPNG, when empty JPEG and PNG
+	// images keep their format and others are converted to PNG.
+	Format string
+	// JPEGQuality is the quality of converted JPEG images, 90 when zero.
+	JPEGQuality int
+	// MaxDimension, when set, downscales images whose width or height is
+	// larger, keeping the aspect ratio.
+	MaxDimension int
+	// Grayscale drops the colors.
+	Grayscale bool
+	// MaxInputSize is the largest image in bytes accepted for
+	// preprocessing, 20 MB when zero. Settings.MaxImageSize applies to the
+	// preprocessed image.
+	MaxInputSize int64
+	// MaxPixels is the largest width times height decoded, 40 million when
+	// zero. Larger images are refused with ErrImagePixels.
+	MaxPixels int
+}
+
+func (self *ImagePreprocess) getJPEGQuality() int {
+	if self.JPEGQuality == 0 {
+		return defaultJPEGQuality
+	}
+
+	return self.JPEGQuality
+}
+
+func (self *ImagePreprocess) getMaxInputSize() int64 {
+	if self.MaxInputSize == 0 {
+		return defaultPreprocessInputSize
+	}
+
+	return self.MaxInputSize
+}
+
+func (self *ImagePreprocess) getMaxPixels() int {
+	if self.MaxPixels == 0 {
+		return defaultPreprocessPixels
+	}
+
+	return self.MaxPixels
+}
+
+// process returns data converted, or data itself when nothing needs to be
+// changed.
+func (self *ImagePreprocess) process(data []byte) ([]byte, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return data, nil
+	}
+
+	target := self.Format
+	if target == "" {
+		target = format
+		if format != ImageFormatJPEG && format != ImageFormatPNG {
+			target = ImageFormatPNG
+		}
+	}
+
+	if int64(config.Width)*int64(config.Height) > int64(self.getMaxPixels()) {
+		return nil, ErrImagePixels
+	}
+
+	scale := self.MaxDimension > 0 && (config.Width > self.MaxDimension || config.Height > self.MaxDimension)
+	if target == format && !scale && !self.Grayscale {
+		return data, nil
+	}
+
+	img, err := decodeFirstFrame(data, format, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if scale {
+		img = downscale(img, self.MaxDimension)
+	}
+
+	if self.Grayscale {
+		gray := image.NewGray(img.Bounds())
+		draw.Draw(gray, gray.Bounds(), flatten(img), img.Bounds().Min, draw.Src)
+		img = gray
+	}
+
+	var buf bytes.Buffer
+	if target == ImageFormatJPEG {
+		err = jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: self.getJPEGQuality()})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeFirstFrame decodes the image, GIF frames are drawn on the full
+// canvas since they may cover only a part of it.
+func decodeFirstFrame(data []byte, format string, config image.Config) (image.Image, error) {
+	if format != "gif" {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		return img, err
+	}
+
+	frame, err := gif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, config.Width, config.Height))
+	draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+	return canvas, nil
+}
+
+// downscale shrinks img to fit max by averaging the source pixels covered by
+// every target pixel.
+func downscale(img image.Image, max int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w >= h {
+		w, h = max, h*max/w
+	} else {
+		w, h = w*max/h, max
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(pr), g+uint64(pg), bl+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+
+	return dst
+}
+
+// flatten draws img on a white background, JPEG has no transparency.
+func flatten(img image.Image) image.Image {
+	if _, ok := img.(*image.Gray); ok {
+		return img
+	}
+
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
+
+// preprocess applies Settings.ImagePreprocess to body.
+func (self *ImageToTextResolver) preprocess(body imageBody) (imageBody, error) {
+	if self.ImagePreprocess == nil {
+		return body, nil
+	}
+
+	if err := body.check(self.ImagePreprocess.getMaxInputSize()); err != nil {
+		return body, err
+	}
+
+	var data []byte
+	var err error
+	if body.src != nil {
+		data, err = body.src.read()
+	} else {
+		data, err = base64.StdEncoding.DecodeString(body.data)
+	}
+	if err != nil {
+		return body, err
+	}
+
+	if len(data) == 0 {
+		return body, nil
+	}
+
+	data, err = self.ImagePreprocess.process(data)
+	if err != nil {
+		return body, err
+	}
+
+	src, err := newImageSource(bytes.NewReader(data))
+	if err != nil {
+		return body, err
+	}
+
+	return imageBody{src: src}, nil
+}
@@ -0,0 +1,123 @@
+package anticaptcha
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestImagePreprocess(t *testing.T) {
+	palette := color.Palette{color.White, color.Black, color.RGBA{255, 0, 0, 255}}
+	first := image.NewPaletted(image.Rect(0, 0, 40, 20), palette)
+	second := image.NewPaletted(image.Rect(0, 0, 40, 20), palette)
+	for i := range second.Pix {
+		second.Pix[i] = 2
+	}
+
+	var animated bytes.Buffer
+	if err := gif.EncodeAll(&animated, &gif.GIF{Image: []*image.Paletted{first, second}, Delay: []int{10, 10}}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	pre := &ImagePreprocess{MaxDimension: 10, Grayscale: true}
+	data, err := pre.process(animated.Bytes())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if format != ImageFormatPNG || img.Bounds().Dx() != 10 || img.Bounds().Dy() != 5 {
+		t.Fatalf("unexpected %s image %v", format, img.Bounds())
+	}
+
+	// the first frame is white, the second one red
+	if c := color.GrayModel.Convert(img.At(5, 2)).(color.Gray); c.Y != 255 {
+		t.Fatalf("unexpected pixel %v", c)
+	}
+
+	var small bytes.Buffer
+	png.Encode(&small, image.NewGray(image.Rect(0, 0, 5, 5)))
+	if data, _ := (&ImagePreprocess{}).process(small.Bytes()); !bytes.Equal(data, small.Bytes()) {
+		t.Fatal("image without changes is encoded again")
+	}
+
+	if data, _ := pre.process([]byte("BM not an image")); string(data) != "BM not an image" {
+		t.Fatal("unknown format is not passed through")
+	}
+}
+
+func TestImagePreprocess_JPEG(t *testing.T) {
+	var transparent bytes.Buffer
+	png.Encode(&transparent, image.NewNRGBA(image.Rect(0, 0, 8, 8)))
+
+	data, err := (&ImagePreprocess{Format: ImageFormatJPEG}).process(transparent.Bytes())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if c := color.GrayModel.Convert(img.At(4, 4)).(color.Gray); format != ImageFormatJPEG || c.Y < 250 {
+		t.Fatalf("unexpected %s pixel %v", format, c)
+	}
+}
+
+func TestImageToTextResolver_PreprocessBeforeSizeCheck(t *testing.T) {
+	noise := image.NewNRGBA(image.Rect(0, 0, 400, 400))
+	rand.New(rand.NewSource(1)).Read(noise.Pix)
+
+	var large bytes.Buffer
+	png.Encode(&large, noise)
+
+	ac := FromSettings(Settings{
+		PingTime:        time.Millisecond,
+		Provider:        &fakeProvider{readyAt: 1},
+		MaxImageSize:    100000,
+		ImagePreprocess: &ImagePreprocess{MaxDimension: 50},
+	})
+
+	if large.Len() <= 100000 {
+		t.Fatalf("test image of %d bytes is too small", large.Len())
+	}
+
+	// a reader that can not seek
+	res, err := ac.ImageToTextResolver().ResolveReader(ioutil.NopCloser(bytes.NewReader(large.Bytes())), nil)
+	if err != nil || res.Solution.Text != "answer" {
+		t.Fatalf("unexpected result %+v, %v", res, err)
+	}
+}
+
+func TestImagePreprocess_MaxPixels(t *testing.T) {
+	var small bytes.Buffer
+	png.Encode(&small, image.NewGray(image.Rect(0, 0, 20, 20)))
+
+	if _, err := (&ImagePreprocess{Grayscale: true, MaxPixels: 100}).process(small.Bytes()); err != ErrImagePixels {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestDownscale_LargeBlocks(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 300, 300))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+
+	// every output pixel averages 90000 source pixels
+	dst := downscale(img, 1)
+	if r, g, b, _ := dst.At(0, 0).RGBA(); r != 0xffff || g != 0xffff || b != 0xffff {
+		t.Fatalf("expected white, got %v %v %v", r, g, b)
+	}
+}
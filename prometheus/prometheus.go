@@ -0,0 +1,105 @@
+// Package prometheus implements anticaptcha.Metrics with prometheus
+// collectors.
+package prometheus
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sintanial/go-anticaptcha"
+)
+
+var _ anticaptcha.Metrics = (*Metrics)(nil)
+
+type Metrics struct {
+	created  *prometheus.CounterVec
+	solved   *prometheus.CounterVec
+	failed   *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	polls    *prometheus.HistogramVec
+	cost     *prometheus.CounterVec
+	inflight prometheus.Gauge
+	balance  prometheus.Gauge
+}
+
+// New creates the collectors with names prefixed by namespace and registers
+// them with reg.
+func New(namespace string, reg prometheus.Registerer) (*Metrics, error) {
+	self := &Metrics{
+		created: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tasks_created_total",
+			Help:      "Number of created tasks.",
+		}, []string{"task_type"}),
+		solved: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tasks_solved_total",
+			Help:      "Number of solved tasks.",
+		}, []string{"task_type"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tasks_failed_total",
+			Help:      "Number of failed tasks by error code.",
+		}, []string{"task_type", "error_code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "solve_duration_seconds",
+			Help:      "Time from task creation to its result.",
+			Buckets:   []float64{5, 10, 15, 20, 30, 45, 60, 90, 120, 180, 300},
+		}, []string{"task_type", "status"}),
+		polls: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "polls_per_task",
+			Help:      "Number of getTaskResult calls per task.",
+			Buckets:   []float64{1, 2, 3, 4, 6, 8, 12, 16, 24, 32, 60},
+		}, []string{"task_type"}),
+		cost: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cost_total",
+			Help:      "Cumulative cost of solved tasks.",
+		}, []string{"task_type"}),
+		inflight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tasks_in_flight",
+			Help:      "Number of tasks being solved.",
+		}),
+		balance: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "balance",
+			Help:      "Last known account balance.",
+		}),
+	}
+
+	for _, c := range []prometheus.Collector{self.created, self.solved, self.failed, self.latency, self.polls, self.cost, self.inflight, self.balance} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return self, nil
+}
+
+func (self *Metrics) TaskCreated(taskType string) {
+	self.created.WithLabelValues(taskType).Inc()
+}
+
+func (self *Metrics) TaskSolved(taskType string, duration time.Duration, polls int, cost float64) {
+	self.solved.WithLabelValues(taskType).Inc()
+	self.latency.WithLabelValues(taskType, "solved").Observe(duration.Seconds())
+	self.polls.WithLabelValues(taskType).Observe(float64(polls))
+	self.cost.WithLabelValues(taskType).Add(cost)
+}
+
+func (self *Metrics) TaskFailed(taskType string, code string, duration time.Duration, polls int) {
+	self.failed.WithLabelValues(taskType, code).Inc()
+	self.latency.WithLabelValues(taskType, "failed").Observe(duration.Seconds())
+	self.polls.WithLabelValues(taskType).Observe(float64(polls))
+}
+
+func (self *Metrics) InFlight(delta int) {
+	self.inflight.Add(float64(delta))
+}
+
+func (self *Metrics) Balance(balance float64) {
+	self.balance.Set(balance)
+}
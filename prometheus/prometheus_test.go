@@ -0,0 +1,68 @@
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := New("test", reg)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	m.TaskCreated("ImageToTextTask")
+	m.TaskSolved("ImageToTextTask", 10*time.Second, 2, 0.0007)
+	m.TaskFailed("ImageToTextTask", "ERROR_CAPTCHA_UNSOLVABLE", time.Second, 1)
+	m.InFlight(1)
+	m.Balance(4.5)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	values := map[string]float64{}
+	for _, f := range families {
+		for _, metric := range f.GetMetric() {
+			switch {
+			case metric.Counter != nil:
+				values[f.GetName()] += metric.Counter.GetValue()
+			case metric.Gauge != nil:
+				values[f.GetName()] += metric.Gauge.GetValue()
+			case metric.Histogram != nil:
+				values[f.GetName()] += float64(metric.Histogram.GetSampleCount())
+			}
+		}
+	}
+
+	want := map[string]float64{
+		"test_tasks_created_total":    1,
+		"test_tasks_solved_total":     1,
+		"test_tasks_failed_total":     1,
+		"test_solve_duration_seconds": 2,
+		"test_polls_per_task":         2,
+		"test_cost_total":             0.0007,
+		"test_tasks_in_flight":        1,
+		"test_balance":                4.5,
+	}
+	for name, value := range want {
+		if values[name] != value {
+			t.Errorf("expected %s = %v, got %v", name, value, values[name])
+		}
+	}
+}
+
+func TestNew_Registered(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if _, err := New("test", reg); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err := New("test", reg); err == nil {
+		t.Fatal("expected an error registering the collectors twice")
+	}
+}
@@ -0,0 +1,450 @@
+package anticaptcha
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Provider is a captcha solving backend. Task ids are strings because not
+// every service uses numeric ids, task payloads and solutions use the
+// anti-captcha JSON format and are converted by the provider if needed.
+type Provider interface {
+	CreateTask(ctx context.Context, s *Settings, task Task) (string, error)
+	// TaskResult returns ErrCaptchaInProcess until the task is solved.
+	TaskResult(ctx context.Context, s *Settings, taskType string, taskId string) (*RawResult, error)
+	Balance(ctx context.Context, s *Settings) (float64, error)
+}
+
+// Task is a task as sent to createTask, Payload marshals to the task object
+// including its type field.
+type Task struct {
+	Type    string
+	Payload interface{}
+}
+
+// RawResult is a solved task, Solution is the solution object in the
+// anti-captcha format.
+type RawResult struct {
+	TaskResult
+	Solution json.RawMessage
+}
+
+// AntiCaptchaProvider talks to anti-captcha and services that copy its api.
+// TaskTypes renames task types the service calls differently. StringIds is
+// set for services with non-numeric task ids, the int based resolver api
+// refuses them with ErrMethodNotSupported.
+type AntiCaptchaProvider struct {
+	BaseURL   string
+	TaskTypes map[string]string
+	StringIds bool
+}
+
+var AntiCaptcha = &AntiCaptchaProvider{BaseURL: "https://api.anti-captcha.com"}
+
+var CapMonsterCloud = &AntiCaptchaProvider{BaseURL: "https://api.capmonster.cloud"}
+
+var CapSolver = &AntiCaptchaProvider{
+	BaseURL: "https://api.capsolver.com",
+	TaskTypes: map[string]string{
+		"NoCaptchaTask":          "ReCaptchaV2Task",
+		"NoCaptchaTaskProxyless": "ReCaptchaV2TaskProxyLess",
+	},
+	StringIds: true,
+}
+
+func (self *AntiCaptchaProvider) CreateTask(ctx context.Context, s *Settings, task Task) (string, error) {
+	payload, err := self.payload(task)
+	if err != nil {
+		return "", err
+	}
+
+	var respdata struct {
+		TaskId taskID `json:"taskId"`
+	}
+
+	reqdata := reqData{Key: s.Key, Task: payload, Language: s.getLang()}
+	if err := s.post(ctx, self.BaseURL+"/createTask", reqdata, &respdata); err != nil {
+		return "", err
+	}
+
+	return string(respdata.TaskId), nil
+}
+
+func (self *AntiCaptchaProvider) payload(task Task) (interface{}, error) {
+	name, ok := self.TaskTypes[task.Type]
+	if !ok {
+		return task.Payload, nil
+	}
+
+	data, err := json.Marshal(task.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	fields["type"], _ = json.Marshal(name)
+	return fields, nil
+}
+
+func (self *AntiCaptchaProvider) TaskResult(ctx context.Context, s *Settings, taskType string, taskId string) (*RawResult, error) {
+	reqdata := struct {
+		Key    string `json:"clientKey"`
+		TaskId taskID `json:"taskId"`
+	}{s.Key, taskID(taskId)}
+
+	var respdata struct {
+		Status     string          `json:"status"`
+		Solution   json.RawMessage `json:"solution"`
+		Cost       json.RawMessage `json:"cost"`
+		Ip         string          `json:"ip"`
+		CreateTime int             `json:"createTime"`
+		EndTime    int             `json:"endTime"`
+		SolveCount json.RawMessage `json:"solveCount"`
+	}
+
+	if err := s.post(ctx, self.BaseURL+"/getTaskResult", reqdata, &respdata); err != nil {
+		return nil, err
+	}
+
+	if respdata.Status != statusReady {
+		return nil, ErrCaptchaInProcess
+	}
+
+	// cost and solveCount are strings at anti-captcha and numbers elsewhere
+	cost, _ := strconv.ParseFloat(strings.Trim(string(respdata.Cost), `"`), 64)
+	solveCount, _ := strconv.Atoi(strings.Trim(string(respdata.SolveCount), `"`))
+
+	return &RawResult{
+		TaskResult: TaskResult{
+			Cost:       cost,
+			Ip:         respdata.Ip,
+			CreateTime: respdata.CreateTime,
+			EndTime:    respdata.EndTime,
+			SolveCount: solveCount,
+		},
+		Solution: respdata.Solution,
+	}, nil
+}
+
+func (self *AntiCaptchaProvider) Balance(ctx context.Context, s *Settings) (float64, error) {
+	reqdata := struct {
+		Key string `json:"clientKey"`
+	}{s.Key}
+
+	var respdata struct {
+		Balance float64 `json:"balance"`
+	}
+
+	if err := s.post(ctx, self.BaseURL+"/getBalance", reqdata, &respdata); err != nil {
+		return 0, err
+	}
+
+	return respdata.Balance, nil
+}
+
+// taskID is sent as a number when it is numeric and as a string otherwise,
+// and accepts both forms in responses.
+type taskID string
+
+func (self taskID) MarshalJSON() ([]byte, error) {
+	if _, err := strconv.ParseUint(string(self), 10, 64); err == nil {
+		return []byte(self), nil
+	}
+
+	return json.Marshal(string(self))
+}
+
+func (self *taskID) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+
+		*self = taskID(s)
+		return nil
+	}
+
+	*self = taskID(data)
+	return nil
+}
+
+func (self *Settings) getProvider() Provider {
+	if self.Provider == nil {
+		return AntiCaptcha
+	}
+
+	return self.Provider
+}
+
+// apiURL returns the base url of an anti-captcha compatible provider, the
+// account methods are not available elsewhere.
+func (self *Settings) apiURL() (string, error) {
+	provider, ok := self.getProvider().(*AntiCaptchaProvider)
+	if !ok {
+		return "", ErrMethodNotSupported
+	}
+
+	return provider.BaseURL, nil
+}
+
+// withKey returns settings using a key from the Keys pool, or self when
+// there is no pool.
+func (self *Settings) withKey(ctx context.Context) (*Settings, error) {
+	if self.Keys == nil {
+		return self, nil
+	}
+
+	key, err := self.Keys.pick(ctx, self)
+	if err != nil {
+		return nil, err
+	}
+
+	s := *self
+	s.Key = key
+	return &s, nil
+}
+
+// withTaskKey returns settings using the key a task of the int based api
+// was created with.
+func (self *Settings) withTaskKey(taskId int) *Settings {
+	if self.Keys == nil {
+		return self
+	}
+
+	key, ok := self.Keys.keyOf(strconv.Itoa(taskId))
+	if !ok {
+		return self
+	}
+
+	s := *self
+	s.Key = key
+	return &s
+}
+
+// solve creates task and waits for its result.
+func (self *Settings) solve(ctx context.Context, task Task) (res *RawResult, err error) {
+	started := time.Now()
+	polls := 0
+
+	ctx, span := self.startSpan(ctx, "anticaptcha.solve", task.Type)
+	defer func() {
+		span.SetAttribute(AttrPolls, polls)
+		if res != nil {
+			span.SetAttribute(AttrCost, res.Cost)
+			span.SetAttribute(AttrWorkerIp, res.Ip)
+			span.SetAttribute(AttrBackend, res.Backend)
+		}
+		endSpan(span, err)
+	}()
+
+	if err := self.queue.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer self.queue.release()
+
+	if self.Metrics != nil {
+		self.Metrics.InFlight(1)
+		defer self.Metrics.InFlight(-1)
+	}
+
+	reserved, err := self.Budget.reserve(self)
+	if err != nil {
+		self.logError(ctx, slog.LevelWarn, "anticaptcha: task refused by budget", err, "task_type", task.Type)
+		self.taskFailed(task.Type, err, started, polls)
+		return nil, err
+	}
+
+	s, err := self.withKey(ctx)
+	if err != nil {
+		self.Budget.release(reserved, 0)
+		self.logError(ctx, slog.LevelError, "anticaptcha: no key for task", err, "task_type", task.Type)
+		self.taskFailed(task.Type, err, started, polls)
+		return nil, err
+	}
+
+	provider := self.getProvider()
+
+	cctx, cspan := self.startSpan(ctx, "anticaptcha.createTask", task.Type)
+	taskId, err := provider.CreateTask(cctx, s, task)
+	cspan.SetAttribute(AttrTaskId, taskId)
+	endSpan(cspan, err)
+	if err != nil {
+		self.Budget.release(reserved, 0)
+		self.Keys.report(s.Key, err)
+		self.logError(ctx, slog.LevelError, "anticaptcha: create task failed", err, "task_type", task.Type, "key", self.redactKey(s.Key))
+		self.taskFailed(task.Type, err, started, polls)
+		return nil, err
+	}
+
+	self.log(ctx, slog.LevelInfo, "anticaptcha: task created", "task_type", task.Type, "task_id", taskId, "key", self.redactKey(s.Key))
+	self.Keys.remember(taskId, s.Key)
+	if self.Metrics != nil {
+		self.Metrics.TaskCreated(task.Type)
+	}
+	span.SetAttribute(AttrTaskId, taskId)
+	self.saveTask(ctx, s, task.Type, taskId)
+
+	err = self.waitResult(ctx, func() (err error) {
+		polls++
+		pctx, pspan := self.startSpan(ctx, "anticaptcha.getTaskResult", task.Type)
+		pspan.SetAttribute(AttrTaskId, taskId)
+		res, err = provider.TaskResult(pctx, s, task.Type, taskId)
+		endSpan(pspan, err)
+		if err == ErrCaptchaInProcess {
+			self.log(ctx, slog.LevelDebug, "anticaptcha: task in process", "task_type", task.Type, "task_id", taskId, "poll", polls)
+		}
+		return err
+	})
+	self.taskDone(ctx, taskId, err)
+	if taskFinal(err) {
+		// the key is kept for ReportIncorrect
+		self.Keys.remember(taskId, s.Key)
+	}
+	if err != nil {
+		self.Budget.release(reserved, 0)
+		self.Keys.report(s.Key, err)
+		self.logError(ctx, slog.LevelError, "anticaptcha: task failed", err, "task_type", task.Type, "task_id", taskId, "polls", polls)
+		self.taskFailed(task.Type, err, started, polls)
+		return nil, err
+	}
+
+	res.TaskId, _ = strconv.Atoi(taskId)
+	self.Budget.release(reserved, res.Cost)
+	self.Keys.add(s.Key, res.Cost)
+
+	self.log(ctx, slog.LevelInfo, "anticaptcha: task solved", "task_type", task.Type, "task_id", taskId, "polls", polls, "cost", res.Cost, "ip", res.Ip, "backend", res.Backend, "duration", time.Since(started))
+	if self.Metrics != nil {
+		self.Metrics.TaskSolved(task.Type, time.Since(started), polls, res.Cost)
+	}
+
+	return res, nil
+}
+
+// taskFinal reports whether a task polled with err is done at the service:
+// it is solved or failed there. Other errors leave the task running.
+func taskFinal(err error) bool {
+	_, ok := err.(*ErrAntiCaptcha)
+	return err == nil || ok
+}
+
+func (self *Settings) taskFailed(taskType string, err error, started time.Time, polls int) {
+	if self.Metrics != nil {
+		self.Metrics.TaskFailed(taskType, ErrorCode(err), time.Since(started), polls)
+	}
+}
+
+// createTask creates task for the int based resolver api. The queue slot is
+// held while the task is created, the budget reservation until its result
+// is loaded.
+func (self *Settings) createTask(task Task) (int, error) {
+	ctx := context.Background()
+	started := time.Now()
+
+	if p, ok := self.getProvider().(*AntiCaptchaProvider); ok && p.StringIds {
+		return 0, ErrMethodNotSupported
+	}
+
+	if err := self.queue.acquire(ctx); err != nil {
+		return 0, err
+	}
+	defer self.queue.release()
+
+	if self.Metrics != nil {
+		self.Metrics.InFlight(1)
+		defer self.Metrics.InFlight(-1)
+	}
+
+	reserved, err := self.Budget.reserve(self)
+	if err != nil {
+		self.logError(ctx, slog.LevelWarn, "anticaptcha: task refused by budget", err, "task_type", task.Type)
+		self.taskFailed(task.Type, err, started, 0)
+		return 0, err
+	}
+
+	s, err := self.withKey(ctx)
+	if err != nil {
+		self.Budget.release(reserved, 0)
+		self.taskFailed(task.Type, err, started, 0)
+		return 0, err
+	}
+
+	taskId, err := self.getProvider().CreateTask(ctx, s, task)
+	if err != nil {
+		self.Budget.release(reserved, 0)
+		self.Keys.report(s.Key, err)
+		self.taskFailed(task.Type, err, started, 0)
+		return 0, err
+	}
+
+	id, err := strconv.Atoi(taskId)
+	if err != nil {
+		self.Budget.release(reserved, 0)
+		self.taskFailed(task.Type, ErrMethodNotSupported, started, 0)
+		return 0, ErrMethodNotSupported
+	}
+
+	self.Budget.hold(taskId, reserved)
+	self.Keys.remember(taskId, s.Key)
+	if self.Metrics != nil {
+		self.Metrics.TaskCreated(task.Type)
+	}
+	self.saveTask(ctx, s, task.Type, taskId)
+
+	return id, nil
+}
+
+// taskResult loads the result of a task and decodes its solution into
+// solution.
+func (self *Settings) taskResult(taskType string, taskId int, solution interface{}) (*TaskResult, error) {
+	s := self.withTaskKey(taskId)
+
+	res, err := self.getProvider().TaskResult(context.Background(), s, taskType, strconv.Itoa(taskId))
+	if err == ErrCaptchaInProcess {
+		return nil, err
+	}
+
+	self.Keys.report(s.Key, err)
+	self.taskDone(context.Background(), strconv.Itoa(taskId), err)
+	if !taskFinal(err) {
+		return nil, err
+	}
+
+	// the key is kept for ReportIncorrect
+	self.Keys.remember(strconv.Itoa(taskId), s.Key)
+
+	// the polls of the caller are not known, the duration is the solve time
+	// reported by the service
+	if err != nil {
+		self.Budget.releaseTask(strconv.Itoa(taskId), 0)
+		if self.Metrics != nil {
+			self.Metrics.TaskFailed(taskType, ErrorCode(err), 0, 1)
+		}
+		return nil, err
+	}
+
+	self.Budget.releaseTask(strconv.Itoa(taskId), res.Cost)
+	self.Keys.add(s.Key, res.Cost)
+	if self.Metrics != nil {
+		var duration time.Duration
+		if res.CreateTime > 0 && res.EndTime >= res.CreateTime {
+			duration = time.Duration(res.EndTime-res.CreateTime) * time.Second
+		}
+		self.Metrics.TaskSolved(taskType, duration, 1, res.Cost)
+	}
+
+	if err := json.Unmarshal(res.Solution, solution); err != nil {
+		return nil, err
+	}
+
+	res.TaskId = taskId
+	return &res.TaskResult, nil
+}
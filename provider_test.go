@@ -0,0 +1,121 @@
+package anticaptcha
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAntiCaptchaProvider_Resolve(t *testing.T) {
+	polls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err.Error())
+			return
+		}
+
+		switch r.URL.Path {
+		case "/createTask":
+			task := req["task"].(map[string]interface{})
+			if task["type"] != "ImageToTextTask" || task["body"] != "aW1hZ2U=" || task["numeric"] != 1.0 {
+				t.Errorf("unexpected task %v", task)
+			}
+			w.Write([]byte(`{"errorId":0,"taskId":7}`))
+		case "/getTaskResult":
+			if req["taskId"] != 7.0 {
+				t.Errorf("unexpected task id %v", req["taskId"])
+			}
+			polls++
+			if polls == 1 {
+				w.Write([]byte(`{"errorId":0,"status":"processing"}`))
+				return
+			}
+			w.Write([]byte(`{"errorId":0,"status":"ready","solution":{"text":"y72bxc"},"cost":"0.000700","solveCount":"0"}`))
+		}
+	}))
+	defer srv.Close()
+
+	ac := FromSettings(Settings{
+		Key:      "key",
+		PingTime: time.Millisecond,
+		Provider: &AntiCaptchaProvider{BaseURL: srv.URL},
+	})
+
+	res, err := ac.ImageToTextResolver().ResolveBytes([]byte("image"), &ImageToTextTask{Numeric: NumericOnlyNumbers})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if res.Solution.Text != "y72bxc" || res.Cost != 0.0007 || polls != 2 {
+		t.Fatalf("unexpected result %+v after %d polls", res, polls)
+	}
+}
+
+func TestTwoCaptchaProvider_Resolve(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/in.php":
+			if r.FormValue("method") != "userrecaptcha" || r.FormValue("googlekey") != "sitekey" {
+				t.Errorf("unexpected form %v", r.Form)
+			}
+			w.Write([]byte(`{"status":1,"request":"2122988149"}`))
+		case "/res.php":
+			if r.FormValue("id") != "2122988149" {
+				t.Errorf("unexpected id %s", r.FormValue("id"))
+			}
+			w.Write([]byte(`{"status":1,"request":"token"}`))
+		}
+	}))
+	defer srv.Close()
+
+	ac := FromSettings(Settings{
+		Key:      "key",
+		PingTime: time.Millisecond,
+		Provider: &TwoCaptchaProvider{BaseURL: srv.URL},
+	})
+
+	res, err := ac.NoCaptchaResolver().SolutionProxyless(NoCaptchaProxylessTask{WebsiteURL: "https://example.com", WebsiteKey: "sitekey"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if res != "token" {
+		t.Fatalf("unexpected token %s", res)
+	}
+}
+
+func TestAntiCaptchaProvider_StringIds(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"errorId":0,"taskId":"61138bb6-19fb-11ec-a9c8-0242ac110006"}`))
+	}))
+	defer srv.Close()
+
+	budget := &Budget{HourlyLimit: 0.002, TaskCost: 0.002}
+	ac := FromSettings(Settings{
+		Key:      "key",
+		Budget:   budget,
+		Provider: &AntiCaptchaProvider{BaseURL: srv.URL, StringIds: true},
+	})
+
+	if _, err := ac.ImageToTextResolver().CreateTask([]byte("image"), nil); err != ErrMethodNotSupported {
+		t.Fatalf("expected ErrMethodNotSupported, got %v", err)
+	}
+
+	if requests != 0 {
+		t.Fatalf("expected no request, got %d", requests)
+	}
+
+	// a service that is not marked fails after the task is created, the
+	// reservation is released
+	ac.Provider = &AntiCaptchaProvider{BaseURL: srv.URL}
+	for i := 0; i < 2; i++ {
+		if _, err := ac.ImageToTextResolver().CreateTask([]byte("image"), nil); err != ErrMethodNotSupported {
+			t.Fatalf("expected ErrMethodNotSupported, got %v", err)
+		}
+	}
+}
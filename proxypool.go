@@ -0,0 +1,85 @@
+package anticaptcha
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProxyPool hands out Proxies in turn to proxy-on tasks created without a
+// proxy. A proxy that fails a task with an ERROR_PROXY_* error is skipped
+// until Cooldown passes.
+type ProxyPool struct {
+	Proxies  []Proxy
+	Cooldown time.Duration
+
+	mu          sync.Mutex
+	next        int
+	failedUntil map[Proxy]time.Time
+}
+
+func (self *ProxyPool) getCooldown() time.Duration {
+	if int64(self.Cooldown) == 0 {
+		return 10 * time.Minute
+	}
+
+	return self.Cooldown
+}
+
+// Pick returns the next proxy that is not cooling down, ErrNoProxy is
+// returned when there is none.
+func (self *ProxyPool) Pick() (Proxy, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	now := time.Now()
+	for i := range self.Proxies {
+		idx := (self.next + i) % len(self.Proxies)
+		if now.Before(self.failedUntil[self.Proxies[idx]]) {
+			continue
+		}
+
+		self.next = idx + 1
+		return self.Proxies[idx], nil
+	}
+
+	return Proxy{}, ErrNoProxy
+}
+
+// Available returns the number of proxies that are not cooling down.
+func (self *ProxyPool) Available() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, p := range self.Proxies {
+		if !now.Before(self.failedUntil[p]) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Report puts p on cooldown if err is a proxy error.
+func (self *ProxyPool) Report(p Proxy, err error) {
+	if !IsProxyError(err) {
+		return
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.failedUntil == nil {
+		self.failedUntil = make(map[Proxy]time.Time)
+	}
+
+	self.failedUntil[p] = time.Now().Add(self.getCooldown())
+}
+
+// IsProxyError reports whether a task failed because of its proxy.
+func IsProxyError(err error) bool {
+	aerr, ok := err.(*ErrAntiCaptcha)
+	return ok && strings.HasPrefix(aerr.Code, "ERROR_PROXY_")
+}
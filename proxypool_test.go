@@ -0,0 +1,52 @@
+package anticaptcha
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProxyPool_Resolve(t *testing.T) {
+	first := Proxy{ProxyHttp, "8.8.8.8", 8080, "", ""}
+	second := Proxy{ProxySocks5, "1.1.1.1", 1080, "user", "pass"}
+	pool := &ProxyPool{Proxies: []Proxy{first, second}}
+
+	resolver := FromSettings(Settings{
+		PingTime: time.Millisecond,
+		Proxies:  pool,
+		Provider: &fakeProvider{readyAt: 1},
+	}).NoCaptchaResolver()
+
+	for _, want := range []Proxy{first, second, first} {
+		res, err := resolver.Resolve(NoCaptchaTask{NoCaptchaProxylessTask: NoCaptchaProxylessTask{WebsiteURL: "https://example.com", WebsiteKey: "key"}})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if res.Proxy != want {
+			t.Fatalf("expected proxy %+v, got %+v", want, res.Proxy)
+		}
+	}
+}
+
+func TestProxyPool_Report(t *testing.T) {
+	first := Proxy{ProxyHttp, "8.8.8.8", 8080, "", ""}
+	second := Proxy{ProxyHttp, "1.1.1.1", 8080, "", ""}
+	pool := &ProxyPool{Proxies: []Proxy{first, second}}
+
+	pool.Report(first, &ErrAntiCaptcha{1, ErrorNoSlotAvailable, ""})
+	pool.Report(second, &ErrAntiCaptcha{1, "ERROR_PROXY_CONNECT_REFUSED", ""})
+	if pool.Available() != 1 {
+		t.Fatalf("expected 1 available proxy, got %d", pool.Available())
+	}
+
+	for i := 0; i < 2; i++ {
+		if p, err := pool.Pick(); err != nil || p != first {
+			t.Fatalf("expected proxy %+v, got %+v %v", first, p, err)
+		}
+	}
+
+	pool.Report(first, &ErrAntiCaptcha{1, "ERROR_PROXY_BANNED", ""})
+	if _, err := pool.Pick(); err != ErrNoProxy {
+		t.Fatalf("expected ErrNoProxy, got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package anticaptcha
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a context that places solves started with it ahead of
+// lower priority ones while they are waiting for a free slot. The default
+// priority is 0, equal priorities are served in FIFO order.
+func WithPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+func priorityFromContext(ctx context.Context) int {
+	if p, ok := ctx.Value(priorityKey{}).(int); ok {
+		return p
+	}
+
+	return 0
+}
+
+// taskQueue limits the number of tasks that are solved at the same time,
+// extra solves wait until one of the running tasks is finished.
+type taskQueue struct {
+	mu       sync.Mutex
+	limit    int
+	inflight int
+	seq      uint64
+	waiters  waiterHeap
+}
+
+func newTaskQueue(limit int) *taskQueue {
+	return &taskQueue{limit: limit}
+}
+
+func (self *taskQueue) acquire(ctx context.Context) error {
+	if self == nil {
+		return nil
+	}
+
+	self.mu.Lock()
+	if self.limit <= 0 || (self.inflight < self.limit && len(self.waiters) == 0) {
+		self.inflight++
+		self.mu.Unlock()
+		return nil
+	}
+
+	self.seq++
+	w := &waiter{priority: priorityFromContext(ctx), seq: self.seq, ready: make(chan struct{})}
+	heap.Push(&self.waiters, w)
+	self.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		self.mu.Lock()
+		if w.index >= 0 {
+			heap.Remove(&self.waiters, w.index)
+			self.mu.Unlock()
+			return ctx.Err()
+		}
+		self.mu.Unlock()
+
+		// slot was handed over right before cancellation, pass it on
+		self.release()
+		return ctx.Err()
+	}
+}
+
+func (self *taskQueue) release() {
+	if self == nil {
+		return
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if len(self.waiters) > 0 {
+		w := heap.Pop(&self.waiters).(*waiter)
+		close(w.ready)
+		return
+	}
+
+	self.inflight--
+}
+
+func (self *taskQueue) depth() int {
+	if self == nil {
+		return 0
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return len(self.waiters)
+}
+
+func (self *taskQueue) running() int {
+	if self == nil {
+		return 0
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.inflight
+}
+
+type waiter struct {
+	priority int
+	seq      uint64
+	index    int
+	ready    chan struct{}
+}
+
+type waiterHeap []*waiter
+
+func (self waiterHeap) Len() int { return len(self) }
+
+func (self waiterHeap) Less(i, j int) bool {
+	if self[i].priority != self[j].priority {
+		return self[i].priority > self[j].priority
+	}
+
+	return self[i].seq < self[j].seq
+}
+
+func (self waiterHeap) Swap(i, j int) {
+	self[i], self[j] = self[j], self[i]
+	self[i].index = i
+	self[j].index = j
+}
+
+func (self *waiterHeap) Push(x interface{}) {
+	w := x.(*waiter)
+	w.index = len(*self)
+	*self = append(*self, w)
+}
+
+func (self *waiterHeap) Pop() interface{} {
+	old := *self
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	w.index = -1
+	*self = old[:n-1]
+	return w
+}
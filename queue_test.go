@@ -0,0 +1,60 @@
+package anticaptcha
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTaskQueue_Priority(t *testing.T) {
+	q := newTaskQueue(1)
+	if err := q.acquire(context.Background()); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	order := make(chan int, 3)
+	for i, p := range []int{0, 5, 0} {
+		go func(i, p int) {
+			if err := q.acquire(WithPriority(context.Background(), p)); err != nil {
+				t.Error(err.Error())
+				return
+			}
+			order <- i
+			q.release()
+		}(i, p)
+
+		for q.depth() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	q.release()
+
+	for _, want := range []int{1, 0, 2} {
+		if got := <-order; got != want {
+			t.Fatalf("expected waiter %d, got %d", want, got)
+		}
+	}
+
+	if q.running() != 0 {
+		t.Fatalf("expected no running tasks, got %d", q.running())
+	}
+}
+
+func TestTaskQueue_Cancel(t *testing.T) {
+	q := newTaskQueue(1)
+	if err := q.acquire(context.Background()); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := q.acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	if q.depth() != 0 {
+		t.Fatalf("expected empty queue, got %d", q.depth())
+	}
+}
@@ -0,0 +1,98 @@
+package anticaptcha
+
+import (
+	"context"
+	"time"
+)
+
+// Queue is a worker queue id for QueueStats.
+type Queue = int
+
+const QueueImageEnglish Queue = 1
+const QueueImageRussian Queue = 2
+const QueueRecaptcha Queue = 5
+const QueueRecaptchaProxyless Queue = 6
+const QueueFunCaptcha Queue = 7
+const QueueFunCaptchaProxyless Queue = 10
+const QueueRecaptchaV3Score03 Queue = 18
+const QueueRecaptchaV3Score07 Queue = 19
+const QueueRecaptchaV3Score09 Queue = 20
+const QueueHCaptcha Queue = 21
+const QueueHCaptchaProxyless Queue = 22
+const QueueRecaptchaEnterprise Queue = 23
+const QueueRecaptchaEnterpriseProxyless Queue = 24
+const QueueAntiGate Queue = 25
+const QueueTurnstile Queue = 26
+const QueueTurnstileProxyless Queue = 27
+
+type QueueStats struct {
+	Waiting int `json:"waiting"`
+	// Load is the percentage of busy workers.
+	Load float64 `json:"load"`
+	// Bid is the average task cost in USD.
+	Bid float64 `json:"bid"`
+	// Speed is the average solving time in seconds.
+	Speed float64 `json:"speed"`
+	Total int     `json:"total"`
+}
+
+// ExpectedWait returns the average solving time of the queue.
+func (self *QueueStats) ExpectedWait() time.Duration {
+	return time.Duration(self.Speed * float64(time.Second))
+}
+
+// QueueStats returns the load of a worker queue. It fails with
+// ErrMethodNotSupported unless Settings.Provider is anti-captcha compatible.
+func (self *Anticaptcha) QueueStats(queueId int) (*QueueStats, error) {
+	baseURL, err := self.apiURL()
+	if err != nil {
+		return nil, err
+	}
+
+	reqdata := struct {
+		Key     string `json:"clientKey"`
+		QueueId int    `json:"queueId"`
+	}{self.Key, queueId}
+
+	res := &QueueStats{}
+	if err := self.post(context.Background(), baseURL+"/getQueueStats", reqdata, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// QueueForTask returns the queue that solves tasks like task, lang is the
+// Settings.Language the task is created with.
+func QueueForTask(task interface{}, lang string) (Queue, error) {
+	switch task.(type) {
+	case ImageToTextTask, *ImageToTextTask:
+		if lang == "rn" {
+			return QueueImageRussian, nil
+		}
+
+		return QueueImageEnglish, nil
+	case NoCaptchaTask, *NoCaptchaTask:
+		return QueueRecaptcha, nil
+	case NoCaptchaProxylessTask, *NoCaptchaProxylessTask:
+		return QueueRecaptchaProxyless, nil
+	}
+
+	return 0, ErrUnknownQueue
+}
+
+// ExpectedWait returns the average solving time of the queue that would
+// solve task.
+func (self *Anticaptcha) ExpectedWait(task interface{}) (time.Duration, error) {
+	queue, err := QueueForTask(task, self.getLang())
+	if err != nil {
+		return 0, err
+	}
+
+	stats, err := self.QueueStats(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	return stats.ExpectedWait(), nil
+}
@@ -0,0 +1,45 @@
+package anticaptcha
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAnticaptcha_QueueStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err.Error())
+			return
+		}
+
+		if r.URL.Path != "/getQueueStats" || req["queueId"] != 6.0 || req["clientKey"] != "key" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, req)
+		}
+		w.Write([]byte(`{"waiting":12,"load":41.5,"bid":0.002,"speed":9.5,"total":100}`))
+	}))
+	defer srv.Close()
+
+	ac := FromSettings(Settings{Key: "key", Provider: &AntiCaptchaProvider{BaseURL: srv.URL}})
+
+	queueId := 6
+	stats, err := ac.QueueStats(queueId)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if stats.Waiting != 12 || stats.ExpectedWait() != 9500*time.Millisecond {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestAnticaptcha_QueueStatsProvider(t *testing.T) {
+	ac := FromSettings(Settings{Key: "key", Provider: &TwoCaptchaProvider{BaseURL: "http://localhost"}})
+
+	if _, err := ac.QueueStats(QueueRecaptchaProxyless); err != ErrMethodNotSupported {
+		t.Fatalf("expected ErrMethodNotSupported, got %v", err)
+	}
+}
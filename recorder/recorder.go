@@ -0,0 +1,216 @@
+// Package recorder records api exchanges to a cassette file and replays
+// them offline. Recording and replaying are anticaptcha middlewares:
+//
+//	rec := recorder.New()
+//	ac := anticaptcha.FromSettings(anticaptcha.Settings{
+//		Key:         key,
+//		Middlewares: []anticaptcha.Middleware{rec.Middleware()},
+//	})
+//	// solve captchas
+//	rec.Save("testdata/solve.json")
+//
+// Client keys and image bodies are scrubbed before they are stored.
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"sync"
+
+	"github.com/go-errors/errors"
+	"github.com/sintanial/go-anticaptcha"
+)
+
+var ErrNoInteraction = errors.New("recorder: no recorded interaction left for request")
+
+const scrubbed = "SCRUBBED"
+
+// scrubFields are request fields replaced before recording.
+var scrubFields = map[string]bool{
+	"clientKey": true,
+	"key":       true,
+	"body":      true,
+}
+
+type Interaction struct {
+	Method     string          `json:"method"`
+	URL        string          `json:"url"`
+	Request    json.RawMessage `json:"request,omitempty"`
+	StatusCode int             `json:"status"`
+	Response   json.RawMessage `json:"response"`
+}
+
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Load reads a cassette file saved by Recorder.Save.
+func Load(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cassette{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+type Recorder struct {
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+func New() *Recorder {
+	return &Recorder{}
+}
+
+// Middleware records every exchange that reaches the api.
+func (self *Recorder) Middleware() anticaptcha.Middleware {
+	return func(next anticaptcha.RoundTrip) anticaptcha.RoundTrip {
+		return func(ctx context.Context, req *anticaptcha.ApiRequest) (*anticaptcha.ApiResponse, error) {
+			resp, err := next(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+
+			reqbody, err := scrub(req.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			respbody := json.RawMessage(resp.Body)
+			if !json.Valid(respbody) {
+				respbody, _ = json.Marshal(string(resp.Body))
+			}
+
+			self.mu.Lock()
+			self.cassette.Interactions = append(self.cassette.Interactions, Interaction{
+				Method:     req.Method,
+				URL:        req.URL,
+				Request:    reqbody,
+				StatusCode: resp.StatusCode,
+				Response:   respbody,
+			})
+			self.mu.Unlock()
+
+			return resp, nil
+		}
+	}
+}
+
+// Cassette returns a copy of the recorded interactions.
+func (self *Recorder) Cassette() *Cassette {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return &Cassette{append([]Interaction(nil), self.cassette.Interactions...)}
+}
+
+// Save writes the recorded interactions to path.
+func (self *Recorder) Save(path string) error {
+	data, err := json.MarshalIndent(self.Cassette(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// scrub marshals a request body with keys and images replaced.
+func scrub(body interface{}) (json.RawMessage, error) {
+	if body == nil {
+		return nil, nil
+	}
+
+	var fields map[string]interface{}
+	if form, ok := body.(url.Values); ok {
+		fields = make(map[string]interface{}, len(form))
+		for name := range form {
+			fields[name] = form.Get(name)
+		}
+	} else {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return data, nil
+		}
+	}
+
+	scrubMap(fields)
+	return json.Marshal(fields)
+}
+
+func scrubMap(fields map[string]interface{}) {
+	for name, value := range fields {
+		if m, ok := value.(map[string]interface{}); ok {
+			scrubMap(m)
+		} else if scrubFields[name] {
+			fields[name] = scrubbed
+		}
+	}
+}
+
+// Replayer answers api requests with the interactions of a cassette. Each
+// request gets the first unused interaction with the same method and url,
+// requests without one fail with ErrNoInteraction.
+type Replayer struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+func NewReplayer(c *Cassette) *Replayer {
+	return &Replayer{cassette: c, used: make([]bool, len(c.Interactions))}
+}
+
+// Middleware answers requests without calling the api.
+func (self *Replayer) Middleware() anticaptcha.Middleware {
+	return func(next anticaptcha.RoundTrip) anticaptcha.RoundTrip {
+		return func(ctx context.Context, req *anticaptcha.ApiRequest) (*anticaptcha.ApiResponse, error) {
+			self.mu.Lock()
+			defer self.mu.Unlock()
+
+			for i, in := range self.cassette.Interactions {
+				if self.used[i] || in.Method != req.Method || in.URL != req.URL {
+					continue
+				}
+
+				self.used[i] = true
+
+				body := []byte(in.Response)
+				var text string
+				if json.Unmarshal(in.Response, &text) == nil {
+					body = []byte(text)
+				}
+
+				return &anticaptcha.ApiResponse{StatusCode: in.StatusCode, Body: body}, nil
+			}
+
+			return nil, ErrNoInteraction
+		}
+	}
+}
+
+// Remaining returns the number of interactions not replayed yet.
+func (self *Replayer) Remaining() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	n := 0
+	for _, used := range self.used {
+		if !used {
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,71 @@
+package recorder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sintanial/go-anticaptcha"
+)
+
+func TestReplayer_ImageToText(t *testing.T) {
+	c, err := Load("testdata/imagetotext.json")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	rp := NewReplayer(c)
+	ac := anticaptcha.FromSettings(anticaptcha.Settings{
+		Key:         "key",
+		PingTime:    time.Millisecond,
+		Middlewares: []anticaptcha.Middleware{rp.Middleware()},
+	})
+
+	res, err := ac.ImageToTextResolver().ResolveBytes([]byte("image"), nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if res.Solution.Text != "y72bxc" || res.Cost != 0.0007 || res.Ip != "46.98.54.221" || res.EndTime != 1472205570 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	if rp.Remaining() != 0 {
+		t.Fatalf("expected all interactions replayed, %d left", rp.Remaining())
+	}
+}
+
+func TestRecorder_Scrub(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errorId":0,"balance":1.5}`))
+	}))
+	defer srv.Close()
+
+	rec := New()
+	ac := anticaptcha.FromSettings(anticaptcha.Settings{
+		Key:         "secret-key",
+		Provider:    &anticaptcha.AntiCaptchaProvider{BaseURL: srv.URL},
+		Middlewares: []anticaptcha.Middleware{rec.Middleware()},
+	})
+
+	if _, err := ac.Balance(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	path := filepath.Join(t.TempDir(), "balance.json")
+	if err := rec.Save(path); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(c.Interactions) != 1 || strings.Contains(string(c.Interactions[0].Request), "secret-key") {
+		t.Fatalf("unexpected cassette %+v", c)
+	}
+}
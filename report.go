@@ -0,0 +1,66 @@
+package anticaptcha
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// Reporter is implemented by providers that accept reports of incorrectly
+// solved tasks.
+type Reporter interface {
+	ReportIncorrect(ctx context.Context, s *Settings, taskType string, taskId string) error
+}
+
+func (self *AntiCaptchaProvider) ReportIncorrect(ctx context.Context, s *Settings, taskType string, taskId string) error {
+	method := "/reportIncorrectRecaptcha"
+	if taskType == "ImageToTextTask" {
+		method = "/reportIncorrectImageCaptcha"
+	}
+
+	reqdata := struct {
+		Key    string `json:"clientKey"`
+		TaskId taskID `json:"taskId"`
+	}{s.Key, taskID(taskId)}
+
+	var respdata struct {
+		Status string `json:"status"`
+	}
+
+	return s.post(ctx, self.BaseURL+method, reqdata, &respdata)
+}
+
+func (self *TwoCaptchaProvider) ReportIncorrect(ctx context.Context, s *Settings, taskType string, taskId string) error {
+	_, err := self.get(ctx, s, url.Values{"action": {"reportbad"}, "id": {taskId}})
+	return err
+}
+
+// ReportIncorrect reports a task to the backend that solved it.
+func (self *Failover) ReportIncorrect(ctx context.Context, s *Settings, taskType string, taskId string) error {
+	self.mu.Lock()
+	ft, ok := self.tasks[taskId]
+	self.mu.Unlock()
+
+	if !ok || ft.winner == nil {
+		return &ErrAntiCaptcha{16, "ERROR_NO_SUCH_CAPCHA_ID", "Task you are requesting does not exist"}
+	}
+
+	reporter, ok := self.Backends[ft.winner.backend].Provider.(Reporter)
+	if !ok {
+		return ErrTaskNotSupported
+	}
+
+	return reporter.ReportIncorrect(ctx, self.settings(s, ft.winner.backend), taskType, ft.winner.taskId)
+}
+
+// reportIncorrect reports a task created through the int based api.
+func (self *Settings) reportIncorrect(taskType string, taskId int) error {
+	reporter, ok := self.getProvider().(Reporter)
+	if !ok {
+		return ErrTaskNotSupported
+	}
+
+	s := self.withTaskKey(taskId)
+
+	return reporter.ReportIncorrect(context.Background(), s, taskType, strconv.Itoa(taskId))
+}
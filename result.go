@@ -6,9 +6,9 @@ type TaskResult struct {
 	CreateTime int     `json:"createTime"`
 	EndTime    int     `json:"endTime"`
 	SolveCount int     `json:"solveCount,string"`
-}
-
-type taskResult struct {
-	respErr
-	Status string `json:"status"`
+	// TaskId is the id of the task that was solved as taken by TaskResult
+	// and ReportIncorrect, zero when the service's ids are not numeric.
+	TaskId int `json:"-"`
+	// Backend is the name of the Failover backend that solved the task.
+	Backend string `json:"-"`
 }
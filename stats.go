@@ -0,0 +1,135 @@
+package anticaptcha
+
+import (
+	"context"
+	"time"
+)
+
+const AppStatsErrors = "errors"
+const AppStatsViews = "views"
+const AppStatsDownloads = "downloads"
+const AppStatsUsers = "users"
+const AppStatsMoney = "money"
+
+// SpendingStatsFilter narrows spending stats down, zero fields are not sent.
+// Queue is the queue name as shown in the console, e.g. "English ImageToText".
+type SpendingStatsFilter struct {
+	Queue  string
+	SoftId int
+	Ip     string
+}
+
+type SpendingStats struct {
+	DateFrom int     `json:"dateFrom"`
+	DateTill int     `json:"dateTill"`
+	Volume   int     `json:"volume"`
+	Money    float64 `json:"money"`
+}
+
+// GetSpendingStats returns hourly spending for the 24 hours up to date, or
+// up to now if date is zero. Like the other stats methods it fails with
+// ErrMethodNotSupported unless Settings.Provider is anti-captcha compatible.
+func (self *Anticaptcha) GetSpendingStats(date time.Time, filter *SpendingStatsFilter) ([]SpendingStats, error) {
+	baseURL, err := self.apiURL()
+	if err != nil {
+		return nil, err
+	}
+
+	reqdata := struct {
+		Key    string `json:"clientKey"`
+		Date   int64  `json:"date,omitempty"`
+		Queue  string `json:"queue,omitempty"`
+		SoftId int    `json:"softId,omitempty"`
+		Ip     string `json:"ip,omitempty"`
+	}{Key: self.Key}
+
+	if !date.IsZero() {
+		reqdata.Date = date.Unix()
+	}
+
+	if filter != nil {
+		reqdata.Queue = filter.Queue
+		reqdata.SoftId = filter.SoftId
+		reqdata.Ip = filter.Ip
+	}
+
+	var respdata struct {
+		Data []SpendingStats `json:"data"`
+	}
+
+	if err := self.post(context.Background(), baseURL+"/getSpendingStats", reqdata, &respdata); err != nil {
+		return nil, err
+	}
+
+	return respdata.Data, nil
+}
+
+// GetSpendingStatsRange returns hourly spending between from and till,
+// requesting the api one day at a time.
+func (self *Anticaptcha) GetSpendingStatsRange(from, till time.Time, filter *SpendingStatsFilter) ([]SpendingStats, error) {
+	var res []SpendingStats
+	seen := make(map[int]bool)
+	for date := till; date.After(from); date = date.Add(-24 * time.Hour) {
+		stats, err := self.GetSpendingStats(date, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := len(stats) - 1; i >= 0; i-- {
+			if seen[stats[i].DateFrom] || int64(stats[i].DateFrom) < from.Unix() || int64(stats[i].DateTill) > till.Unix() {
+				continue
+			}
+
+			seen[stats[i].DateFrom] = true
+			res = append(res, stats[i])
+		}
+	}
+
+	// collected newest first, return in chronological order
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+
+	return res, nil
+}
+
+type AppStatsPoint struct {
+	Date      string  `json:"date"`
+	ShortDate string  `json:"shortDate"`
+	Value     float64 `json:"y"`
+	BeginTime int     `json:"beginTime"`
+	EndTime   int     `json:"endTime"`
+}
+
+type AppStatsSeries struct {
+	Name string          `json:"name"`
+	Data []AppStatsPoint `json:"data"`
+}
+
+type AppStats struct {
+	ChartData []AppStatsSeries `json:"chartData"`
+	FromDate  string           `json:"fromDate"`
+	ToDate    string           `json:"toDate"`
+}
+
+// GetAppStats returns statistics of the application registered under softId,
+// mode is one of the AppStats* constants, an empty mode means AppStatsErrors.
+func (self *Anticaptcha) GetAppStats(softId int, mode string) (*AppStats, error) {
+	baseURL, err := self.apiURL()
+	if err != nil {
+		return nil, err
+	}
+
+	reqdata := struct {
+		Key    string `json:"clientKey"`
+		SoftId int    `json:"softId"`
+		Mode   string `json:"mode,omitempty"`
+	}{self.Key, softId, mode}
+
+	res := &AppStats{}
+	if err := self.post(context.Background(), baseURL+"/getAppStats", reqdata, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
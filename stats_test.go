@@ -0,0 +1,55 @@
+package anticaptcha
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAnticaptcha_GetSpendingStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err.Error())
+			return
+		}
+
+		if r.URL.Path != "/getSpendingStats" || req["date"] != 1700000000.0 || req["queue"] != "English ImageToText" || req["ip"] != nil {
+			t.Errorf("unexpected request %s %v", r.URL.Path, req)
+		}
+		w.Write([]byte(`{"errorId":0,"data":[{"dateFrom":1699996400,"dateTill":1699999999,"volume":3,"money":0.0021}]}`))
+	}))
+	defer srv.Close()
+
+	ac := FromSettings(Settings{Key: "key", Provider: &AntiCaptchaProvider{BaseURL: srv.URL}})
+
+	stats, err := ac.GetSpendingStats(time.Unix(1700000000, 0), &SpendingStatsFilter{Queue: "English ImageToText"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(stats) != 1 || stats[0].Volume != 3 || stats[0].Money != 0.0021 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestAnticaptcha_GetAppStatsError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errorId":1,"errorCode":"ERROR_KEY_DOES_NOT_EXIST","errorDescription":"Account authorization key not found in the system"}`))
+	}))
+	defer srv.Close()
+
+	ac := FromSettings(Settings{Key: "key", Provider: &AntiCaptchaProvider{BaseURL: srv.URL}})
+
+	_, err := ac.GetAppStats(1, AppStatsMoney)
+	if e, ok := err.(*ErrAntiCaptcha); !ok || e.Code != ErrorKeyDoesNotExist {
+		t.Fatalf("expected key error, got %v", err)
+	}
+
+	ac = FromSettings(Settings{Key: "key", Provider: TwoCaptcha})
+	if _, err := ac.GetAppStats(1, AppStatsMoney); err != ErrMethodNotSupported {
+		t.Fatalf("expected ErrMethodNotSupported, got %v", err)
+	}
+}
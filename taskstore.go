@@ -0,0 +1,239 @@
+package anticaptcha
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TaskStore persists created tasks until their result is collected, so that
+// tasks of a process that stopped mid-solve can be resumed with Recover.
+type TaskStore interface {
+	Save(rec TaskRecord) error
+	Delete(taskId string) error
+	List() ([]TaskRecord, error)
+}
+
+// TaskRecord is a created task. KeyHash is only set when the task was
+// created with a key of the Keys pool, it is a fingerprint of the key which
+// is looked up in the pool when the task is resumed.
+type TaskRecord struct {
+	TaskId    string    `json:"taskId"`
+	Type      string    `json:"type"`
+	KeyHash   string    `json:"keyHash,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// RecoveredTask is the outcome of a task resumed by Recover, Result.Solution
+// decodes into the solution type of the task, e.g. ImageToTextSolution.
+type RecoveredTask struct {
+	TaskRecord
+	Result *RawResult
+	Err    error
+}
+
+// FileTaskStore keeps task records in a JSON file which is rewritten
+// atomically on every change.
+type FileTaskStore struct {
+	path string
+
+	mu      sync.Mutex
+	records map[string]TaskRecord
+}
+
+// NewFileTaskStore opens the store at path, the file is created on the first
+// save.
+func NewFileTaskStore(path string) (*FileTaskStore, error) {
+	self := &FileTaskStore{path: path, records: map[string]TaskRecord{}}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return self, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var records []TaskRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+
+	for _, rec := range records {
+		self.records[rec.TaskId] = rec
+	}
+
+	return self, nil
+}
+
+func (self *FileTaskStore) Save(rec TaskRecord) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.records[rec.TaskId] = rec
+	return self.write()
+}
+
+func (self *FileTaskStore) Delete(taskId string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if _, ok := self.records[taskId]; !ok {
+		return nil
+	}
+
+	delete(self.records, taskId)
+	return self.write()
+}
+
+func (self *FileTaskStore) List() ([]TaskRecord, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.list(), nil
+}
+
+func (self *FileTaskStore) list() []TaskRecord {
+	records := make([]TaskRecord, 0, len(self.records))
+	for _, rec := range self.records {
+		records = append(records, rec)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+
+	return records
+}
+
+func (self *FileTaskStore) write() error {
+	data, err := json.Marshal(self.list())
+	if err != nil {
+		return err
+	}
+
+	tmp := self.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, self.path)
+}
+
+// saveTask records a created task in the Tasks store.
+func (self *Settings) saveTask(ctx context.Context, s *Settings, taskType string, taskId string) {
+	if self.Tasks == nil {
+		return
+	}
+
+	// failover task ids can not be polled after a restart
+	if _, ok := self.getProvider().(*Failover); ok {
+		return
+	}
+
+	rec := TaskRecord{TaskId: taskId, Type: taskType, CreatedAt: time.Now()}
+	if self.Keys != nil {
+		rec.KeyHash = keyHash(s.Key)
+	}
+
+	if err := self.Tasks.Save(rec); err != nil {
+		self.logError(ctx, slog.LevelWarn, "anticaptcha: save task failed", err, "task_type", taskType, "task_id", taskId)
+	}
+}
+
+// taskDone removes a task from the Tasks store once its result can not be
+// collected later: it is solved or failed at the service.
+func (self *Settings) taskDone(ctx context.Context, taskId string, err error) {
+	if self.Tasks == nil {
+		return
+	}
+
+	if !taskFinal(err) {
+		return
+	}
+
+	if err := self.Tasks.Delete(taskId); err != nil {
+		self.logError(ctx, slog.LevelWarn, "anticaptcha: delete task failed", err, "task_id", taskId)
+	}
+}
+
+// Recover resumes polling of the tasks left in the Tasks store by a previous
+// run and waits for their results. Tasks of a Failover provider can not be
+// recovered since its task ids only live in memory.
+func (self *Anticaptcha) Recover(ctx context.Context) ([]RecoveredTask, error) {
+	s := self.settings()
+	if s.Tasks == nil {
+		return nil, nil
+	}
+
+	records, err := s.Tasks.List()
+	if err != nil {
+		return nil, err
+	}
+
+	recovered := make([]RecoveredTask, len(records))
+
+	var wg sync.WaitGroup
+	for i, rec := range records {
+		wg.Add(1)
+		go func(i int, rec TaskRecord) {
+			defer wg.Done()
+
+			res, err := s.resume(ctx, rec)
+			recovered[i] = RecoveredTask{rec, res, err}
+		}(i, rec)
+	}
+	wg.Wait()
+
+	return recovered, nil
+}
+
+func (self *Settings) resume(ctx context.Context, rec TaskRecord) (*RawResult, error) {
+	s := *self
+	if rec.KeyHash != "" {
+		if key, ok := self.Keys.byHash(rec.KeyHash); ok {
+			s.Key = key
+		} else {
+			self.log(ctx, slog.LevelWarn, "anticaptcha: key of recovered task is not in the pool", "task_type", rec.Type, "task_id", rec.TaskId)
+		}
+	}
+
+	provider := self.getProvider()
+
+	var res *RawResult
+	err := self.waitResult(ctx, func() (err error) {
+		res, err = provider.TaskResult(ctx, &s, rec.Type, rec.TaskId)
+		return err
+	})
+	self.taskDone(ctx, rec.TaskId, err)
+	if err != nil {
+		self.logError(ctx, slog.LevelError, "anticaptcha: recovered task failed", err, "task_type", rec.Type, "task_id", rec.TaskId)
+		return nil, err
+	}
+
+	self.Budget.add(res.Cost)
+	self.Keys.add(s.Key, res.Cost)
+
+	self.log(ctx, slog.LevelInfo, "anticaptcha: task recovered", "task_type", rec.Type, "task_id", rec.TaskId, "cost", res.Cost, "age", time.Since(rec.CreatedAt))
+
+	return res, nil
+}
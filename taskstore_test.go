@@ -0,0 +1,126 @@
+package anticaptcha
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnticaptcha_Recover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+
+	store, err := NewFileTaskStore(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err := store.Save(TaskRecord{TaskId: "7", Type: "ImageToTextTask", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// a restarted process opens the store again
+	store, err = NewFileTaskStore(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ac := FromSettings(Settings{
+		PingTime: time.Millisecond,
+		Provider: &fakeProvider{readyAt: 2, cost: 0.001},
+		Tasks:    store,
+	})
+
+	recovered, err := ac.Recover(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(recovered) != 1 || recovered[0].Err != nil || recovered[0].TaskId != "7" {
+		t.Fatalf("unexpected recovered tasks %+v", recovered)
+	}
+
+	var solution ImageToTextSolution
+	if err := json.Unmarshal(recovered[0].Result.Solution, &solution); err != nil || solution.Text != "answer" {
+		t.Fatalf("unexpected solution %s", recovered[0].Result.Solution)
+	}
+
+	if records, _ := store.List(); len(records) != 0 {
+		t.Fatalf("recovered task is still stored: %+v", records)
+	}
+}
+
+func TestFileTaskStore_Solve(t *testing.T) {
+	store, err := NewFileTaskStore(filepath.Join(t.TempDir(), "tasks.json"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ac := FromSettings(Settings{
+		PingTime: time.Millisecond,
+		Provider: &fakeProvider{readyAt: 1},
+		Tasks:    store,
+	})
+
+	if _, err := ac.ImageToTextResolver().ResolveBytes([]byte("image"), nil); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if records, _ := store.List(); len(records) != 0 {
+		t.Fatalf("solved task is still stored: %+v", records)
+	}
+}
+
+func TestAnticaptcha_RecoverKeyHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+
+	store, err := NewFileTaskStore(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ac := FromSettings(Settings{
+		Keys:     &KeyPool{Keys: []string{"SUPERSECRETKEY"}},
+		Provider: &fakeProvider{},
+		Tasks:    store,
+	})
+
+	if _, err := ac.ImageToTextResolver().CreateTask([]byte("image"), nil); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if strings.Contains(string(data), "SUPERSECRETKEY") {
+		t.Fatalf("key in task file: %s", data)
+	}
+
+	// a restarted process with the same pool
+	store, err = NewFileTaskStore(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	provider := &keyProvider{fakeProvider: fakeProvider{readyAt: 1}}
+	provider.keys = []string{"", ""} // skip the transient error
+	ac = FromSettings(Settings{
+		PingTime: time.Millisecond,
+		Keys:     &KeyPool{Keys: []string{"other", "SUPERSECRETKEY"}},
+		Provider: provider,
+		Tasks:    store,
+	})
+
+	recovered, err := ac.Recover(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(recovered) != 1 || recovered[0].Err != nil || provider.keys[2] != "SUPERSECRETKEY" {
+		t.Fatalf("unexpected recovery %+v with keys %v", recovered, provider.keys)
+	}
+}
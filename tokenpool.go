@@ -0,0 +1,267 @@
+package anticaptcha
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultPoolSize = 2
+const defaultTokenTTL = 110 * time.Second
+const defaultPoolRetryDelay = 5 * time.Second
+
+// TokenPool keeps solved recaptcha tokens ready per site, so that a token is
+// handed out without waiting for a worker. Tokens are solved in the
+// background with Resolver and dropped TokenTTL after they are solved.
+// Sites are added on their first Token or Warm call and kept warm until
+// Close, or until they are not used for IdleTimeout. Only recaptcha v2 tokens
+// are pooled, hCaptcha is not supported.
+type TokenPool struct {
+	Resolver *NoCaptchaResolver
+	// Size is the number of tokens kept per site, 2 when zero.
+	Size int
+	// TokenTTL is how long a token is handed out after it is solved, 110
+	// seconds when zero.
+	TokenTTL time.Duration
+	// RetryDelay is the pause of a site's refills after a failed solve, 5
+	// seconds when zero.
+	RetryDelay time.Duration
+	// IdleTimeout, when set, stops refilling sites not asked for a token
+	// for this long.
+	IdleTimeout time.Duration
+	// OnError is called with failed background solves.
+	OnError func(t NoCaptchaProxylessTask, err error)
+
+	once   sync.Once
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	sites map[NoCaptchaProxylessTask]*tokenSite
+}
+
+type tokenSite struct {
+	tokens   []pooledToken
+	solving  int
+	waiters  []chan tokenResult
+	retryAt  time.Time
+	lastUsed time.Time
+}
+
+type pooledToken struct {
+	token   string
+	expires time.Time
+}
+
+type tokenResult struct {
+	token string
+	err   error
+}
+
+func (self *TokenPool) getSize() int {
+	if self.Size == 0 {
+		return defaultPoolSize
+	}
+
+	return self.Size
+}
+
+func (self *TokenPool) getTokenTTL() time.Duration {
+	if int64(self.TokenTTL) == 0 {
+		return defaultTokenTTL
+	}
+
+	return self.TokenTTL
+}
+
+func (self *TokenPool) getRetryDelay() time.Duration {
+	if int64(self.RetryDelay) == 0 {
+		return defaultPoolRetryDelay
+	}
+
+	return self.RetryDelay
+}
+
+func (self *TokenPool) init() {
+	self.once.Do(func() {
+		self.ctx, self.cancel = context.WithCancel(context.Background())
+		self.sites = map[NoCaptchaProxylessTask]*tokenSite{}
+		go self.run()
+	})
+}
+
+// run drops expired tokens and refills sites every second.
+func (self *TokenPool) run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-self.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		self.mu.Lock()
+		for t, site := range self.sites {
+			if self.IdleTimeout > 0 && len(site.waiters) == 0 && time.Since(site.lastUsed) > self.IdleTimeout {
+				delete(self.sites, t)
+				continue
+			}
+
+			self.fill(t, site)
+		}
+		self.mu.Unlock()
+	}
+}
+
+// site returns the state of t, it is created when missing. Called with mu
+// held.
+func (self *TokenPool) site(t NoCaptchaProxylessTask) *tokenSite {
+	site, ok := self.sites[t]
+	if !ok {
+		site = &tokenSite{}
+		self.sites[t] = site
+	}
+
+	site.lastUsed = time.Now()
+	return site
+}
+
+// Warm starts solving tokens for t ahead of the first Token call.
+func (self *TokenPool) Warm(t NoCaptchaProxylessTask) {
+	self.init()
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.fill(t, self.site(t))
+}
+
+// Token returns a ready token for t, or waits for one to be solved until ctx
+// is done. Errors of solves made while waiting are returned.
+func (self *TokenPool) Token(ctx context.Context, t NoCaptchaProxylessTask) (string, error) {
+	self.init()
+
+	self.mu.Lock()
+	site := self.site(t)
+	site.prune()
+
+	if len(site.tokens) > 0 {
+		token := site.tokens[0].token
+		site.tokens = site.tokens[1:]
+		self.fill(t, site)
+		self.mu.Unlock()
+		return token, nil
+	}
+
+	ch := make(chan tokenResult, 1)
+	site.waiters = append(site.waiters, ch)
+	self.fill(t, site)
+	self.mu.Unlock()
+
+	select {
+	case res := <-ch:
+		return res.token, res.err
+	case <-ctx.Done():
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	for i, waiter := range site.waiters {
+		if waiter == ch {
+			site.waiters = append(site.waiters[:i], site.waiters[i+1:]...)
+			break
+		}
+	}
+
+	// a token delivered meanwhile goes back to the pool
+	select {
+	case res := <-ch:
+		if res.err == nil {
+			site.tokens = append(site.tokens, pooledToken{res.token, time.Now().Add(self.getTokenTTL())})
+		}
+	default:
+	}
+
+	return "", ctx.Err()
+}
+
+// Len returns the number of ready tokens for t.
+func (self *TokenPool) Len(t NoCaptchaProxylessTask) int {
+	self.init()
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	site, ok := self.sites[t]
+	if !ok {
+		return 0
+	}
+
+	site.prune()
+	return len(site.tokens)
+}
+
+// Close stops the background solves, tokens being solved are abandoned.
+func (self *TokenPool) Close() {
+	self.init()
+	self.cancel()
+}
+
+func (self *tokenSite) prune() {
+	now := time.Now()
+	for len(self.tokens) > 0 && now.After(self.tokens[0].expires) {
+		self.tokens = self.tokens[1:]
+	}
+}
+
+// fill starts solves until the ready and solving tokens cover Size and the
+// waiters. Called with mu held.
+func (self *TokenPool) fill(t NoCaptchaProxylessTask, site *tokenSite) {
+	if self.ctx.Err() != nil || time.Now().Before(site.retryAt) {
+		return
+	}
+
+	site.prune()
+	for len(site.tokens)+site.solving < self.getSize()+len(site.waiters) {
+		site.solving++
+		go self.solve(t, site)
+	}
+}
+
+func (self *TokenPool) solve(t NoCaptchaProxylessTask, site *tokenSite) {
+	res, err := self.Resolver.ResolveProxylessContext(self.ctx, t)
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	site.solving--
+
+	if err != nil {
+		if self.ctx.Err() != nil {
+			return
+		}
+
+		site.retryAt = time.Now().Add(self.getRetryDelay())
+		if len(site.waiters) > 0 {
+			site.waiters[0] <- tokenResult{err: err}
+			site.waiters = site.waiters[1:]
+		}
+		if self.OnError != nil {
+			go self.OnError(t, err)
+		}
+		return
+	}
+
+	token := res.Solution.GRecaptchaResponse
+	if len(site.waiters) > 0 {
+		site.waiters[0] <- tokenResult{token: token}
+		site.waiters = site.waiters[1:]
+	} else {
+		site.tokens = append(site.tokens, pooledToken{token, time.Now().Add(self.getTokenTTL())})
+	}
+
+	self.fill(t, site)
+}
@@ -0,0 +1,76 @@
+package anticaptcha
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type tokenProvider struct {
+	mu      sync.Mutex
+	created int
+}
+
+func (self *tokenProvider) CreateTask(ctx context.Context, s *Settings, task Task) (string, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.created++
+	return strconv.Itoa(self.created), nil
+}
+
+func (self *tokenProvider) TaskResult(ctx context.Context, s *Settings, taskType string, taskId string) (*RawResult, error) {
+	solution, _ := json.Marshal(NoCaptchaSolution{GRecaptchaResponse: "token-" + taskId})
+	return &RawResult{Solution: solution}, nil
+}
+
+func (self *tokenProvider) Balance(ctx context.Context, s *Settings) (float64, error) {
+	return 1, nil
+}
+
+func TestTokenPool(t *testing.T) {
+	provider := &tokenProvider{}
+	ac := FromSettings(Settings{PingTime: time.Millisecond, Provider: provider})
+	pool := &TokenPool{Resolver: ac.NoCaptchaResolver(), Size: 2}
+	defer pool.Close()
+
+	site := NoCaptchaProxylessTask{WebsiteURL: "https://example.com", WebsiteKey: "sitekey"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	token, err := pool.Token(ctx, site)
+	if err != nil || token == "" {
+		t.Fatalf("unexpected token %q, %v", token, err)
+	}
+
+	for pool.Len(site) < 2 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("pool is not refilled")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	token, err = pool.Token(ctx, site)
+	if err != nil || token == "" {
+		t.Fatalf("unexpected token %q, %v", token, err)
+	}
+}
+
+func TestTokenPool_Expiry(t *testing.T) {
+	ac := FromSettings(Settings{PingTime: time.Millisecond, Provider: &tokenProvider{}})
+	pool := &TokenPool{Resolver: ac.NoCaptchaResolver(), Size: 1, TokenTTL: time.Nanosecond}
+	defer pool.Close()
+
+	site := NoCaptchaProxylessTask{WebsiteURL: "https://example.com", WebsiteKey: "sitekey"}
+	pool.Warm(site)
+	time.Sleep(20 * time.Millisecond)
+
+	if n := pool.Len(site); n != 0 {
+		t.Fatalf("%d expired tokens are kept", n)
+	}
+}
@@ -0,0 +1,52 @@
+package anticaptcha
+
+import (
+	"context"
+)
+
+// Tracer starts spans around solving and api calls, see the otel subpackage
+// for an OpenTelemetry implementation.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type Span interface {
+	SetAttribute(key string, value interface{})
+	// End finishes the span, err is the error the operation failed with.
+	End(err error)
+}
+
+const AttrTaskType = "anticaptcha.task_type"
+const AttrTaskId = "anticaptcha.task_id"
+const AttrCost = "anticaptcha.cost"
+const AttrWorkerIp = "anticaptcha.worker_ip"
+const AttrErrorCode = "anticaptcha.error_code"
+const AttrBackend = "anticaptcha.backend"
+const AttrPolls = "anticaptcha.polls"
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+
+func (noopSpan) End(err error) {}
+
+func (self *Settings) startSpan(ctx context.Context, name string, taskType string) (context.Context, Span) {
+	if self.Tracer == nil {
+		return ctx, noopSpan{}
+	}
+
+	ctx, span := self.Tracer.Start(ctx, name)
+	span.SetAttribute(AttrTaskType, taskType)
+	return ctx, span
+}
+
+// endSpan sets the error code attribute of failed operations and ends span.
+func endSpan(span Span, err error) {
+	if err != nil && err != ErrCaptchaInProcess {
+		span.SetAttribute(AttrErrorCode, ErrorCode(err))
+		span.End(err)
+		return
+	}
+
+	span.End(nil)
+}
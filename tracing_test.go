@@ -0,0 +1,90 @@
+package anticaptcha
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeTracer struct {
+	mu    sync.Mutex
+	spans []*fakeSpan
+}
+
+type fakeSpan struct {
+	name  string
+	attrs map[string]interface{}
+	err   error
+	ended bool
+}
+
+func (self *fakeTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	span := &fakeSpan{name: name, attrs: map[string]interface{}{}}
+	self.spans = append(self.spans, span)
+	return ctx, span
+}
+
+func (self *fakeSpan) SetAttribute(key string, value interface{}) {
+	self.attrs[key] = value
+}
+
+func (self *fakeSpan) End(err error) {
+	self.err = err
+	self.ended = true
+}
+
+func TestTracer_Solve(t *testing.T) {
+	tracer := &fakeTracer{}
+	ac := FromSettings(Settings{
+		PingTime: time.Millisecond,
+		Tracer:   tracer,
+		Provider: &fakeProvider{readyAt: 2, cost: 0.0007},
+	})
+
+	if _, err := ac.ImageToTextResolver().ResolveBytes([]byte("image"), nil); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	names := map[string]int{}
+	for _, span := range tracer.spans {
+		names[span.name]++
+		if !span.ended || span.err != nil || span.attrs[AttrTaskType] != "ImageToTextTask" {
+			t.Errorf("unexpected span %+v", span)
+		}
+	}
+
+	if names["anticaptcha.solve"] != 1 || names["anticaptcha.createTask"] != 1 || names["anticaptcha.getTaskResult"] != 2 {
+		t.Fatalf("unexpected spans %v", names)
+	}
+
+	solve := tracer.spans[0]
+	if solve.attrs[AttrTaskId] != "1" || solve.attrs[AttrPolls] != 2 || solve.attrs[AttrCost] != 0.0007 {
+		t.Fatalf("unexpected solve attributes %v", solve.attrs)
+	}
+}
+
+func TestTracer_CreateFailed(t *testing.T) {
+	tracer := &fakeTracer{}
+	ac := FromSettings(Settings{
+		Tracer:   tracer,
+		Provider: &fakeProvider{createErr: &ErrAntiCaptcha{2, ErrorNoSlotAvailable, ""}},
+	})
+
+	if _, err := ac.ImageToTextResolver().ResolveBytes([]byte("image"), nil); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(tracer.spans))
+	}
+
+	for _, span := range tracer.spans {
+		if span.err == nil || span.attrs[AttrErrorCode] != ErrorNoSlotAvailable {
+			t.Fatalf("error not recorded on span %+v", span)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package anticaptcha
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// TwoCaptchaProvider talks to services using the 2captcha in.php/res.php
+// api. Errors are returned as *ErrAntiCaptcha with Id 1 and the 2captcha
+// error code, the task cost is not reported.
+type TwoCaptchaProvider struct {
+	BaseURL string
+	SoftId  int
+}
+
+var TwoCaptcha = &TwoCaptchaProvider{BaseURL: "https://2captcha.com"}
+
+func (self *TwoCaptchaProvider) CreateTask(ctx context.Context, s *Settings, task Task) (string, error) {
+	form := url.Values{}
+	form.Set("key", s.Key)
+	form.Set("json", "1")
+	if self.SoftId > 0 {
+		form.Set("soft_id", strconv.Itoa(self.SoftId))
+	}
+
+	switch t := task.Payload.(type) {
+	case *imageToTextTask:
+		body, err := t.Body.encode()
+		if err != nil {
+			return "", err
+		}
+		form.Set("method", "base64")
+		form.Set("body", body)
+		if t.Phrase {
+			form.Set("phrase", "1")
+		}
+		if t.Case {
+			form.Set("regsense", "1")
+		}
+		if t.Numeric > 0 {
+			form.Set("numeric", strconv.Itoa(t.Numeric))
+		}
+		if t.Math {
+			form.Set("calc", "1")
+		}
+		if t.MinRespLen > 0 {
+			form.Set("min_len", strconv.Itoa(t.MinRespLen))
+		}
+		if t.MaxRespLen > 0 {
+			form.Set("max_len", strconv.Itoa(t.MaxRespLen))
+		}
+		if s.getLang() == "rn" {
+			form.Set("language", "1")
+		}
+	case *noCaptchaProxylessTask:
+		setTwoCaptchaRecaptcha(form, t.NoCaptchaProxylessTask)
+	case *noCaptchaTask:
+		setTwoCaptchaRecaptcha(form, t.NoCaptchaProxylessTask)
+
+		proxy := t.ProxyAddress + ":" + strconv.Itoa(t.ProxyPort)
+		if t.ProxyLogin != "" {
+			proxy = t.ProxyLogin + ":" + t.ProxyPassword + "@" + proxy
+		}
+		form.Set("proxy", proxy)
+		form.Set("proxytype", strings.ToUpper(t.ProxyType))
+		form.Set("userAgent", t.UserAgent)
+		if t.Cookies != "" {
+			form.Set("cookies", twoCaptchaCookies(t.Cookies))
+		}
+	default:
+		return "", ErrTaskNotSupported
+	}
+
+	return self.do(ctx, s, &ApiRequest{Method: http.MethodPost, URL: self.BaseURL + "/in.php", Body: form})
+}
+
+func setTwoCaptchaRecaptcha(form url.Values, t NoCaptchaProxylessTask) {
+	form.Set("method", "userrecaptcha")
+	form.Set("googlekey", t.WebsiteKey)
+	form.Set("pageurl", t.WebsiteURL)
+	if t.WebsiteSToken != "" {
+		form.Set("data-s", t.WebsiteSToken)
+	}
+}
+
+// twoCaptchaCookies converts "name=value; name2=value2" cookies to the
+// "name:value;name2:value2" format.
+func twoCaptchaCookies(cookies string) string {
+	var pairs []string
+	for _, pair := range strings.Split(cookies, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair != "" {
+			pairs = append(pairs, strings.Replace(pair, "=", ":", 1))
+		}
+	}
+
+	return strings.Join(pairs, ";")
+}
+
+func (self *TwoCaptchaProvider) TaskResult(ctx context.Context, s *Settings, taskType string, taskId string) (*RawResult, error) {
+	answer, err := self.get(ctx, s, url.Values{"action": {"get"}, "id": {taskId}})
+	if err != nil {
+		return nil, err
+	}
+
+	field := "gRecaptchaResponse"
+	if taskType == "ImageToTextTask" {
+		field = "text"
+	}
+
+	solution, err := json.Marshal(map[string]string{field: answer})
+	if err != nil {
+		return nil, err
+	}
+
+	return &RawResult{Solution: solution}, nil
+}
+
+func (self *TwoCaptchaProvider) Balance(ctx context.Context, s *Settings) (float64, error) {
+	balance, err := self.get(ctx, s, url.Values{"action": {"getbalance"}})
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(balance, 64)
+}
+
+func (self *TwoCaptchaProvider) get(ctx context.Context, s *Settings, query url.Values) (string, error) {
+	query.Set("key", s.Key)
+	query.Set("json", "1")
+
+	return self.do(ctx, s, &ApiRequest{Method: http.MethodGet, URL: self.BaseURL + "/res.php", Body: query})
+}
+
+// do sends req and returns the request field of the answer.
+func (self *TwoCaptchaProvider) do(ctx context.Context, s *Settings, req *ApiRequest) (string, error) {
+	resp, err := s.roundTrip(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	var respdata struct {
+		Status    int             `json:"status"`
+		Request   json.RawMessage `json:"request"`
+		ErrorText string          `json:"error_text"`
+	}
+
+	if err := json.Unmarshal(resp.Body, &respdata); err != nil {
+		return "", err
+	}
+
+	// request is a string for most answers and a number for balances
+	var request string
+	if err := json.Unmarshal(respdata.Request, &request); err != nil {
+		request = string(respdata.Request)
+	}
+	if respdata.Status == 1 {
+		return request, nil
+	}
+
+	if request == "CAPCHA_NOT_READY" {
+		return "", ErrCaptchaInProcess
+	}
+
+	return "", &ErrAntiCaptcha{1, request, respdata.ErrorText}
+}